@@ -2,8 +2,10 @@ package shardmap
 
 import (
 	"hash/maphash"
+	"iter"
 	"runtime"
 	"sync"
+	"sync/atomic"
 
 	rhh "github.com/tidwall/hashmap"
 )
@@ -15,18 +17,41 @@ type Map[K comparable, V any] struct {
 	shards int
 	mus    []sync.RWMutex
 	maps   []*rhh.Map[K, V]
+	counts []atomic.Int64 // entries per shard, see LenApprox
 
-	seed maphash.Seed
+	seed   maphash.Seed
+	hasher func(key K) uint64 // replaces maphash and seed when set
 
 	zeroV V
 }
 
+// Option configures a Map created by New.
+type Option[K comparable, V any] func(m *Map[K, V])
+
+// WithHasher makes the map place keys on shards using hash instead of maphash. A
+// shard is picked from the low bits of the hash, so hash must spread keys well
+// over its low bits, and it must be deterministic for the lifetime of the map.
+func WithHasher[K comparable, V any](hash func(key K) uint64) Option[K, V] {
+	return func(m *Map[K, V]) {
+		m.hasher = hash
+	}
+}
+
 // New returns a new hashmap with the specified capacity. This function is only
 // needed when you must define a minimum capacity, otherwise just use:
 //
 //	var m shardmap.Map
-func New[K comparable, V any](cap int) *Map[K, V] {
-	return &Map[K, V]{cap: cap}
+//
+// A negative capacity is treated as zero.
+func New[K comparable, V any](cap int, opts ...Option[K, V]) *Map[K, V] {
+	if cap < 0 {
+		cap = 0
+	}
+	m := &Map[K, V]{cap: cap}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
 }
 
 // Clear out all values from map
@@ -34,7 +59,8 @@ func (m *Map[K, V]) Clear() {
 	m.initDo()
 	for i := 0; i < m.shards; i++ {
 		m.mus[i].Lock()
-		m.maps[i] = rhh.New[K, V](m.cap / m.shards)
+		m.maps[i] = rhh.New[K, V](m.shardCap())
+		m.counts[i].Store(0)
 		m.mus[i].Unlock()
 	}
 }
@@ -46,6 +72,9 @@ func (m *Map[K, V]) Set(key K, value V) (prev V, replaced bool) {
 	shard := m.choose(key)
 	m.mus[shard].Lock()
 	prev, replaced = m.maps[shard].Set(key, value)
+	if !replaced {
+		m.counts[shard].Add(1)
+	}
 	m.mus[shard].Unlock()
 	return prev, replaced
 }
@@ -71,12 +100,37 @@ func (m *Map[K, V]) SetAccept(key K, value V, accept func(prev V, replaced bool)
 				// reset updated data
 				m.maps[shard].Set(key, prev)
 			}
-			prev, replaced = m.zeroV, false
+			return m.zeroV, false
 		}
 	}
+	if !replaced {
+		m.counts[shard].Add(1)
+	}
 	return prev, replaced
 }
 
+// GetOrSet returns the value of key if it is present, with loaded set. Otherwise
+// it stores value and returns it with loaded false. The lookup and the store are
+// done under a single hold of the key's shard lock, like sync.Map's LoadOrStore.
+func (m *Map[K, V]) GetOrSet(key K, value V) (actual V, loaded bool) {
+	m.initDo()
+	shard := m.choose(key)
+	m.mus[shard].Lock()
+	if actual, loaded = m.maps[shard].Get(key); !loaded {
+		m.maps[shard].Set(key, value)
+		m.counts[shard].Add(1)
+		actual = value
+	}
+	m.mus[shard].Unlock()
+	return actual, loaded
+}
+
+// Swap stores value for key and returns the value it replaced, with loaded set if
+// key was present. It matches sync.Map's Swap and is otherwise the same as Set.
+func (m *Map[K, V]) Swap(key K, value V) (previous V, loaded bool) {
+	return m.Set(key, value)
+}
+
 // Get returns a value for a key.
 // Returns false when no value has been assign for key.
 func (m *Map[K, V]) Get(key K) (value V, ok bool) {
@@ -95,6 +149,9 @@ func (m *Map[K, V]) Delete(key K) (prev V, deleted bool) {
 	shard := m.choose(key)
 	m.mus[shard].Lock()
 	prev, deleted = m.maps[shard].Delete(key)
+	if deleted {
+		m.counts[shard].Add(-1)
+	}
 	m.mus[shard].Unlock()
 	return prev, deleted
 }
@@ -117,25 +174,42 @@ func (m *Map[K, V]) DeleteAccept(key K, accept func(prev V, replaced bool) bool)
 				// reset updated data
 				m.maps[shard].Set(key, prev)
 			}
-			prev, deleted = m.zeroV, false
+			return m.zeroV, false
 		}
 	}
-
+	if deleted {
+		m.counts[shard].Add(-1)
+	}
 	return prev, deleted
 }
 
-// Len returns the number of values in map.
+// Len returns the number of values in map. It only takes each shard's read lock,
+// so it does not block concurrent readers.
 func (m *Map[K, V]) Len() int {
 	m.initDo()
 	var len int
 	for i := 0; i < m.shards; i++ {
-		m.mus[i].Lock()
+		m.mus[i].RLock()
 		len += m.maps[i].Len()
-		m.mus[i].Unlock()
+		m.mus[i].RUnlock()
 	}
 	return len
 }
 
+// LenApprox returns the number of values in map without taking any locks, by
+// summing per-shard counters that Set and Delete maintain. Under concurrent
+// mutation the result may be momentarily stale, as each shard's counter is read at
+// a slightly different time, but it catches up once writes stop. It is meant for
+// frequent size queries such as metrics, where Len would contend with writers.
+func (m *Map[K, V]) LenApprox() int {
+	m.initDo()
+	var len int64
+	for i := 0; i < m.shards; i++ {
+		len += m.counts[i].Load()
+	}
+	return int(len)
+}
+
 // Range iterates overall all key/values.
 // It's not safe to call or Set or Delete while ranging.
 func (m *Map[K, V]) Range(iter func(key K, value V) bool) {
@@ -159,20 +233,72 @@ func (m *Map[K, V]) Range(iter func(key K, value V) bool) {
 	}
 }
 
+// RangeWithShard iterates over all key/values like Range, also passing the index
+// of the shard that holds each entry. It's not safe to call or Set or Delete while
+// ranging.
+func (m *Map[K, V]) RangeWithShard(iter func(shard int, key K, value V) bool) {
+	m.initDo()
+	var done bool
+	for i := 0; i < m.shards; i++ {
+		func() {
+			m.mus[i].RLock()
+			defer m.mus[i].RUnlock()
+			m.maps[i].Scan(func(key K, value V) bool {
+				if !iter(i, key, value) {
+					done = true
+					return false
+				}
+				return true
+			})
+		}()
+		if done {
+			break
+		}
+	}
+}
+
+// All returns a sequence of all key/values, for use with range:
+//
+//	for k, v := range m.All() {
+//		...
+//	}
+//
+// It iterates like Range, holding each shard's read lock while that shard's
+// entries are yielded. It's not safe to call Set or Delete in the loop body.
+func (m *Map[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		m.Range(yield)
+	}
+}
+
 func (m *Map[K, V]) choose(key K) int {
+	if m.hasher != nil {
+		return int(m.hasher(key) & uint64(m.shards-1))
+	}
 	return int(maphash.Comparable(m.seed, key) & uint64(m.shards-1))
 }
 
+// shardCap returns the capacity each shard is created with. It is never negative.
+func (m *Map[K, V]) shardCap() int {
+	return max(m.cap/m.shards, 0)
+}
+
 func (m *Map[K, V]) initDo() {
 	m.init.Do(func() {
-
+		if m.cap < 0 {
+			m.cap = 0
+		}
+		// GOMAXPROCS, unlike NumCPU, follows the CPU quota of a container. It is
+		// never below 1, so there are at least 16 shards.
+		procs := max(runtime.GOMAXPROCS(0), 1)
 		m.shards = 1
-		for m.shards < runtime.NumCPU()*16 {
+		for m.shards < procs*16 {
 			m.shards *= 2
 		}
-		scap := m.cap / m.shards
+		scap := m.shardCap()
 		m.mus = make([]sync.RWMutex, m.shards)
 		m.maps = make([]*rhh.Map[K, V], m.shards)
+		m.counts = make([]atomic.Int64, m.shards)
 		for i := 0; i < len(m.maps); i++ {
 			m.maps[i] = rhh.New[K, V](scap)
 		}
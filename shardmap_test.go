@@ -7,6 +7,7 @@ package shardmap
 import (
 	"fmt"
 	"math/rand"
+	"runtime"
 	"strconv"
 	"testing"
 	"time"
@@ -313,3 +314,265 @@ func TestClear(t *testing.T) {
 
 }
 
+func TestSetPrev(t *testing.T) {
+	var m Map[string, int]
+	// prev is a V, so no type assertion is needed
+	var prev int
+	prev, replaced := m.Set("a", 1)
+	if replaced || prev != 0 {
+		t.Fatalf("expected %v/%v, got %v/%v", 0, false, prev, replaced)
+	}
+	prev, replaced = m.Set("a", 2)
+	if !replaced || prev != 1 {
+		t.Fatalf("expected %v/%v, got %v/%v", 1, true, prev, replaced)
+	}
+}
+
+func TestGetOrSet(t *testing.T) {
+	var m Map[string, int]
+	if actual, loaded := m.GetOrSet("a", 1); loaded || actual != 1 {
+		t.Fatalf("expected %v/%v, got %v/%v", 1, false, actual, loaded)
+	}
+	if actual, loaded := m.GetOrSet("a", 2); !loaded || actual != 1 {
+		t.Fatalf("expected %v/%v, got %v/%v", 1, true, actual, loaded)
+	}
+	if v, _ := m.Get("a"); v != 1 {
+		t.Fatalf("expected %v, got %v", 1, v)
+	}
+	if m.Len() != 1 {
+		t.Fatalf("expected %v, got %v", 1, m.Len())
+	}
+}
+
+func TestSwap(t *testing.T) {
+	var m Map[string, int]
+	if prev, loaded := m.Swap("a", 0); loaded || prev != 0 {
+		t.Fatalf("expected %v/%v, got %v/%v", 0, false, prev, loaded)
+	}
+	// the stored zero value is still reported as loaded
+	if prev, loaded := m.Swap("a", 1); !loaded || prev != 0 {
+		t.Fatalf("expected %v/%v, got %v/%v", 0, true, prev, loaded)
+	}
+	if prev, loaded := m.Swap("a", 2); !loaded || prev != 1 {
+		t.Fatalf("expected %v/%v, got %v/%v", 1, true, prev, loaded)
+	}
+	if v, _ := m.Get("a"); v != 2 {
+		t.Fatalf("expected %v, got %v", 2, v)
+	}
+}
+
+func TestWithHasher(t *testing.T) {
+	m := New[int, int](0, WithHasher[int, int](func(key int) uint64 { return uint64(key) }))
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	for i := 0; i < m.shards; i++ {
+		m.maps[i].Scan(func(key, value int) bool {
+			if key&(m.shards-1) != i {
+				t.Fatalf("key %v: expected shard %v, got %v", key, key&(m.shards-1), i)
+			}
+			return true
+		})
+	}
+	for i := 0; i < 1000; i++ {
+		if v, ok := m.Get(i); !ok || v != i {
+			t.Fatalf("expected %v, got %v", i, v)
+		}
+	}
+}
+
+func TestLenApprox(t *testing.T) {
+	var m Map[string, int]
+	for i := 0; i < 1000; i++ {
+		m.Set(k(i), i)
+		m.Set(k(i), i)
+	}
+	m.GetOrSet(k(0), 0)
+	m.GetOrSet("new", 0)
+	m.SetAccept("rejected", 0, func(int, bool) bool { return false })
+	m.SetAccept("accepted", 0, func(int, bool) bool { return true })
+	for i := 0; i < 500; i++ {
+		m.Delete(k(i))
+		m.Delete(k(i))
+	}
+	m.DeleteAccept(k(500), func(int, bool) bool { return false })
+	m.DeleteAccept(k(501), func(int, bool) bool { return true })
+	if m.LenApprox() != m.Len() || m.Len() != 501 {
+		t.Fatalf("expected %v, got %v (Len %v)", 501, m.LenApprox(), m.Len())
+	}
+	m.Clear()
+	if m.LenApprox() != 0 {
+		t.Fatalf("expected %v, got %v", 0, m.LenApprox())
+	}
+}
+
+func TestNewCapacity(t *testing.T) {
+	for _, cap := range []int{0, -1, -5, 1} {
+		m := New[string, int](cap)
+		if m.cap < 0 {
+			t.Fatalf("New(%d): expected non-negative cap, got %v", cap, m.cap)
+		}
+		for i := 0; i < 100; i++ {
+			m.Set(k(i), i)
+		}
+		if m.Len() != 100 {
+			t.Fatalf("New(%d): expected %v, got %v", cap, 100, m.Len())
+		}
+		for i := 0; i < 100; i++ {
+			v, ok := m.Get(k(i))
+			if !ok || v != i {
+				t.Fatalf("New(%d): expected %v, got %v", cap, i, v)
+			}
+		}
+		for i := 0; i < 100; i++ {
+			if _, ok := m.Delete(k(i)); !ok {
+				t.Fatalf("New(%d): expected true", cap)
+			}
+		}
+		m.Clear()
+		if m.Len() != 0 {
+			t.Fatalf("New(%d): expected %v, got %v", cap, 0, m.Len())
+		}
+		// Clear reallocates the shards with the same capacity
+		m.Set("a", 1)
+		if v, ok := m.Get("a"); !ok || v != 1 {
+			t.Fatalf("New(%d): after Clear: expected %v, got %v", cap, 1, v)
+		}
+	}
+}
+
+func TestLowGOMAXPROCS(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+	var m Map[string, int]
+	for i := 0; i < 1000; i++ {
+		m.Set(k(i), i)
+	}
+	if m.shards != 16 {
+		t.Fatalf("expected %v, got %v", 16, m.shards)
+	}
+	for i := 0; i < 1000; i++ {
+		if v, ok := m.Get(k(i)); !ok || v != i {
+			t.Fatalf("key %v: expected %v, got %v", k(i), i, v)
+		}
+	}
+}
+
+func TestLenDoesNotBlockReaders(t *testing.T) {
+	var m Map[string, int]
+	for i := 0; i < 100; i++ {
+		m.Set(k(i), i)
+	}
+	// Hold every shard's read lock like in-flight Gets would. A Len that takes
+	// write locks would block until they are released.
+	for i := range m.mus {
+		m.mus[i].RLock()
+	}
+	done := make(chan int)
+	go func() {
+		done <- m.Len()
+	}()
+	select {
+	case n := <-done:
+		if n != 100 {
+			t.Fatalf("expected %v, got %v", 100, n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Len blocked on readers")
+	}
+	if v, ok := m.Get(k(1)); !ok || v != 1 {
+		t.Fatalf("expected %v, got %v", 1, v)
+	}
+	for i := range m.mus {
+		m.mus[i].RUnlock()
+	}
+}
+
+// BenchmarkGetWithLen measures Gets while another goroutine keeps calling Len.
+func BenchmarkGetWithLen(b *testing.B) {
+	var m Map[int, int]
+	for i := 0; i < 1<<16; i++ {
+		m.Set(i, i)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				m.Len()
+			}
+		}
+	}()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var i int
+		for pb.Next() {
+			m.Get(i & (1<<16 - 1))
+			i++
+		}
+	})
+}
+
+func TestAll(t *testing.T) {
+	var m Map[string, int]
+	for range m.All() {
+		t.Fatal("expected no entries")
+	}
+	for i := 0; i < 1000; i++ {
+		m.Set(k(i), i)
+	}
+	seen := map[string]int{}
+	for key, value := range m.All() {
+		if _, ok := seen[key]; ok {
+			t.Fatalf("key %v returned twice", key)
+		}
+		seen[key] = value
+	}
+	if len(seen) != 1000 {
+		t.Fatalf("expected %v, got %v", 1000, len(seen))
+	}
+	for i := 0; i < 1000; i++ {
+		if seen[k(i)] != i {
+			t.Fatalf("expected %v, got %v", i, seen[k(i)])
+		}
+	}
+
+	var n int
+	for range m.All() {
+		n++
+		break
+	}
+	if n != 1 {
+		t.Fatalf("expected %v, got %v", 1, n)
+	}
+	// the shard locks must have been released by the break
+	m.Set("after", 1)
+}
+
+func TestRangeWithShard(t *testing.T) {
+	var m Map[string, int]
+	for i := 0; i < 1000; i++ {
+		m.Set(k(i), i)
+	}
+	var n int
+	m.RangeWithShard(func(shard int, key string, value int) bool {
+		if shard != m.choose(key) {
+			t.Fatalf("key %v: expected shard %v, got %v", key, m.choose(key), shard)
+		}
+		n++
+		return true
+	})
+	if n != 1000 {
+		t.Fatalf("expected %v, got %v", 1000, n)
+	}
+	n = 0
+	m.RangeWithShard(func(int, string, int) bool {
+		n++
+		return false
+	})
+	if n != 1 {
+		t.Fatalf("expected %v, got %v", 1, n)
+	}
+}
@@ -0,0 +1,27 @@
+package shardmap
+
+// Number is the constraint of the value types Add works with.
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64
+}
+
+// Add adds delta to the value of key, treating an absent key as zero, and returns
+// the new total. The read and the store happen under a single write lock of the
+// key's shard, so concurrent Adds to the same key cannot lose each other's
+// updates, which makes a Map of numbers usable as a set of counters. Integer
+// totals wrap around on overflow like the + operator.
+func Add[K comparable, N Number](m *Map[K, N], key K, delta N) N {
+	m.checkWrite()
+	if m.interner != nil {
+		key = m.interner.intern(key)
+	}
+	tab, shard := m.lockKey(key)
+	cur, _ := tab.maps[shard].Get(key)
+	total := cur + delta
+	prev, replaced := m.setLocked(tab, shard, key, total)
+	tab.mus[shard].Unlock()
+	m.afterSet(key, total, prev, replaced)
+	return total
+}
@@ -0,0 +1,46 @@
+package shardmap
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestAdd(t *testing.T) {
+	var m Map[string, int]
+	if got := Add(&m, "a", 2); got != 2 {
+		t.Fatalf("expected %v, got %v", 2, got)
+	}
+	if got := Add(&m, "a", -5); got != -3 {
+		t.Fatalf("expected %v, got %v", -3, got)
+	}
+	if v, _ := m.Get("a"); v != -3 {
+		t.Fatalf("expected %v, got %v", -3, v)
+	}
+
+	type ms float64
+	var f Map[string, ms]
+	Add(&f, "a", 0.5)
+	if got := Add(&f, "a", 0.25); got != 0.75 {
+		t.Fatalf("expected %v, got %v", 0.75, got)
+	}
+}
+
+func TestAddConcurrent(t *testing.T) {
+	var m Map[int, uint64]
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				Add(&m, i%10, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	for i := 0; i < 10; i++ {
+		if got, _ := m.Get(i); got != 800 {
+			t.Fatalf("key %v: expected %v, got %v", i, 800, got)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package shardmap
+
+import rhh "github.com/johnsiilver/shardmap/v2/hashmap"
+
+// Append appends data to the value of key, creating the value if key is absent,
+// under a single write lock of the key's shard. Compared to a Get, append and Set,
+// the existing bytes are not copied unless the slice has to grow, and concurrent
+// Appends to the same key cannot lose each other's data.
+//
+// The value grows like a slice grown with the builtin append: when its capacity is
+// exceeded it is reallocated with room to spare, so building a value of n bytes
+// with many Appends copies O(n) bytes in total. The spare capacity is kept, which
+// means a value can use up to about twice its length in memory. Append only writes
+// into spare capacity it allocated itself: a value stored any other way, say by
+// Set, may share its backing array with the caller, so the first Append to it
+// copies it.
+//
+// A slice returned by Get shares its backing array with the stored value. Its
+// bytes stay valid, as Append only writes past the end of the old value, but
+// callers must not append to or modify it themselves. Data is copied, so the
+// caller may reuse it after Append returns.
+func Append[K comparable](m *Map[K, []byte], key K, data []byte) {
+	m.checkWrite()
+	if m.interner != nil {
+		key = m.interner.intern(key)
+	}
+	tab, shard := m.lockKey(key)
+	cur, _ := tab.maps[shard].Get(key)
+	grown := tab.grown[shard]
+	if grown == nil || !grown.Contains(key) {
+		cur = cur[:len(cur):len(cur)]
+	}
+	value := append(cur, data...)
+	prev, replaced := m.setLocked(tab, shard, key, value)
+	if grown == nil {
+		grown = rhh.New[K, bool](0)
+		tab.grown[shard] = grown
+	}
+	grown.Set(key, true)
+	tab.mus[shard].Unlock()
+	m.afterSet(key, value, prev, replaced)
+}
@@ -0,0 +1,96 @@
+package shardmap
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestAppend(t *testing.T) {
+	var m Map[string, []byte]
+	data := []byte("ab")
+	Append(&m, "a", data)
+	data[0] = 'x'
+	Append(&m, "a", []byte("cd"))
+	before, _ := m.Get("a")
+	Append(&m, "a", []byte("ef"))
+	if got, _ := m.Get("a"); string(got) != "abcdef" {
+		t.Fatalf("expected %q, got %q", "abcdef", got)
+	}
+	if string(before) != "abcd" {
+		t.Fatalf("expected %q, got %q", "abcd", before)
+	}
+	if m.Len() != 1 {
+		t.Fatalf("expected %v, got %v", 1, m.Len())
+	}
+}
+
+func TestAppendCallerBuffer(t *testing.T) {
+	var m Map[string, []byte]
+	buf := []byte("abXY")
+	m.Set("a", buf[:2])
+	Append(&m, "a", []byte("cd"))
+	if string(buf) != "abXY" {
+		t.Fatalf("expected the caller's buffer to stay %q, got %q", "abXY", buf)
+	}
+	if got, _ := m.Get("a"); string(got) != "abcd" {
+		t.Fatalf("expected %q, got %q", "abcd", got)
+	}
+
+	// the grown value is the map's own, until a Set replaces it
+	Append(&m, "a", []byte("ef"))
+	got, _ := m.Get("a")
+	m.Set("a", got[:2])
+	Append(&m, "a", []byte("gh"))
+	if string(got) != "abcdef" {
+		t.Fatalf("expected %q, got %q", "abcdef", got)
+	}
+	if got, _ := m.Get("a"); string(got) != "abgh" {
+		t.Fatalf("expected %q, got %q", "abgh", got)
+	}
+}
+
+func TestAppendConcurrent(t *testing.T) {
+	var m Map[int, []byte]
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				Append(&m, i%10, []byte{'x'})
+			}
+		}()
+	}
+	wg.Wait()
+	for i := 0; i < 10; i++ {
+		if got, _ := m.Get(i); len(got) != 800 {
+			t.Fatalf("key %v: expected %v bytes, got %v", i, 800, len(got))
+		}
+	}
+}
+
+func BenchmarkAppend(b *testing.B) {
+	data := make([]byte, 64)
+	keys := make([]string, 100)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+
+	b.Run("Append", func(b *testing.B) {
+		var m Map[string, []byte]
+		for i := 0; i < b.N; i++ {
+			Append(&m, keys[i%len(keys)], data)
+		}
+	})
+	b.Run("GetAppendSet", func(b *testing.B) {
+		var m Map[string, []byte]
+		for i := 0; i < b.N; i++ {
+			key := keys[i%len(keys)]
+			cur, _ := m.Get(key)
+			next := make([]byte, 0, len(cur)+len(data))
+			next = append(append(next, cur...), data...)
+			m.Set(key, next)
+		}
+	})
+}
@@ -0,0 +1,380 @@
+package shardmap
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// LoadParallel copies every entry of src into m using up to workers goroutines,
+// overwriting existing values. If workers is <= 0, runtime.GOMAXPROCS(0) is used.
+//
+// When src and m share a shard layout (m was created with src.NewLike or the
+// reverse, with no custom shard function) the copy is shard aligned: each worker
+// takes a shard index, copies that source shard under its read lock and writes the
+// entries into the same shard of m under a single write lock. Workers never contend
+// on the same shard. Maps using WithHasher are never treated as sharing a layout, as
+// two hash functions cannot be compared, so they always use the path below.
+//
+// Otherwise the general fan-out path is used: each worker copies a source shard
+// under its read lock and then Sets the entries into m, which may contend with
+// other workers writing to the same destination shard.
+//
+// src may be read concurrently, but writes to src during the load may or may not
+// be observed.
+func (m *Map[K, V]) LoadParallel(src *Map[K, V], workers int) {
+	m.checkWrite()
+	if src == m {
+		return
+	}
+	tab := m.holdTable()
+	defer m.layout.exit()
+	srcTab := src.table()
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	workers = min(workers, srcTab.shards)
+
+	aligned := tab.aligned(srcTab)
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var buf []kv[K, V]
+			for {
+				shard := int(next.Add(1) - 1)
+				if shard >= srcTab.shards {
+					return
+				}
+				buf = srcTab.appendShard(buf[:0], shard)
+				if aligned {
+					m.loadShard(tab, shard, buf, nil)
+					continue
+				}
+				for _, e := range buf {
+					m.Set(e.key, e.value)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// ApplyDelta merges every entry of delta into m, storing combine(current, delta)
+// for each key, where current is the zero value of V when m does not hold the key.
+// This is meant for repeatedly folding in deltas from other replicas, such as
+// G-Counter style state where combine adds or takes the maximum.
+//
+// Work is grouped by shard: each shard of delta is copied under its read lock and
+// each affected shard of m is write locked once to apply all of its entries. When
+// the maps share a shard layout (see LoadParallel) the shards map one to one.
+//
+// For CRDT semantics combine must be commutative and associative (and idempotent
+// if a delta may be applied more than once); the map only applies it and does not
+// check. combine runs under m's shard write lock and must not call into m.
+func (m *Map[K, V]) ApplyDelta(delta *Map[K, V], combine func(cur V, delta V) V) {
+	m.checkWrite()
+	m.mergeFrom(delta, func(cur V, _ bool, v V) V { return combine(cur, v) })
+}
+
+// Merge stores every entry of other in m. For a key m already holds, the stored
+// value is onConflict(existing, incoming); a nil onConflict keeps the incoming
+// value, overwriting the existing one. Like ApplyDelta, each shard of other is
+// copied under its read lock, which is released before the affected shards of m
+// are write locked once each, so other may be read concurrently and writes to other
+// during the merge may or may not be included. onConflict runs under m's shard
+// write lock and must not call into m.
+func (m *Map[K, V]) Merge(other *Map[K, V], onConflict func(existing, incoming V) V) {
+	m.checkWrite()
+	if onConflict == nil {
+		m.mergeFrom(other, nil)
+		return
+	}
+	m.mergeFrom(other, func(cur V, exists bool, v V) V {
+		if !exists {
+			return v
+		}
+		return onConflict(cur, v)
+	})
+}
+
+// mergeFrom stores every entry of src in m with combine as in loadShard, grouping
+// the work by shard.
+func (m *Map[K, V]) mergeFrom(src *Map[K, V], combine func(cur V, exists bool, v V) V) {
+	tab := m.holdTable()
+	defer m.layout.exit()
+	srcTab := src.table()
+
+	var buf []kv[K, V]
+	if tab.aligned(srcTab) {
+		for i := 0; i < srcTab.shards; i++ {
+			buf = srcTab.appendShard(buf[:0], i)
+			m.loadShard(tab, i, buf, combine)
+		}
+		return
+	}
+	groups := make([][]kv[K, V], tab.shards)
+	for i := 0; i < srcTab.shards; i++ {
+		buf = srcTab.appendShard(buf[:0], i)
+		for _, e := range buf {
+			shard := tab.choose(e.key)
+			groups[shard] = append(groups[shard], e)
+		}
+	}
+	for shard, group := range groups {
+		if len(group) > 0 {
+			m.loadShard(tab, shard, group, combine)
+		}
+	}
+}
+
+// SetMany stores every entry of entries, overwriting existing values. Entries are
+// grouped by shard first and each shard is then write locked once to store all of
+// its entries, instead of once per entry as with a loop of Sets.
+func (m *Map[K, V]) SetMany(entries map[K]V) {
+	m.checkWrite()
+	tab := m.holdTable()
+	defer m.layout.exit()
+	keys := make([]K, 0, len(entries))
+	for k := range entries {
+		keys = append(keys, k)
+	}
+	var batch []kv[K, V]
+	for shard, group := range tab.groupKeys(keys) {
+		if len(group) == 0 {
+			continue
+		}
+		batch = batch[:0]
+		for _, k := range group {
+			batch = append(batch, kv[K, V]{k, entries[k]})
+		}
+		m.loadShard(tab, shard, batch, nil)
+	}
+}
+
+// GetMany returns the values of the given keys that are present; absent keys are
+// missing from the result. Keys are grouped by shard and each shard is read locked
+// once to look up all of its keys. The result is consistent per shard but not
+// across shards.
+func (m *Map[K, V]) GetMany(keys []K) map[K]V {
+	for {
+		tab := m.table()
+		out := make(map[K]V, len(keys))
+		for shard, group := range tab.groupKeys(keys) {
+			if len(group) == 0 {
+				continue
+			}
+			tab.mus[shard].RLock()
+			for _, key := range group {
+				if v, ok := tab.maps[shard].Get(key); ok {
+					out[key] = v
+				}
+			}
+			tab.mus[shard].RUnlock()
+		}
+		// a table is never reused once replaced, so if it is still current it was
+		// current for every lookup
+		if m.tab.Load() == tab {
+			return out
+		}
+	}
+}
+
+// PopMany deletes the given keys and returns the values that were removed. Keys are
+// grouped by shard and each shard is write locked once, so every present key is
+// removed by exactly one caller even with concurrent PopMany calls over the same
+// keys. Keys that are not present are absent from the result.
+func (m *Map[K, V]) PopMany(keys []K) map[K]V {
+	m.checkWrite()
+	tab := m.holdTable()
+	defer m.layout.exit()
+	out := make(map[K]V, len(keys))
+	var popped []kv[K, V]
+	for shard, group := range tab.groupKeys(keys) {
+		if len(group) == 0 {
+			continue
+		}
+		popped = m.removeShard(tab, shard, group, popped[:0])
+		for _, e := range popped {
+			out[e.key] = e.value
+		}
+	}
+	return out
+}
+
+// DeleteMany deletes the given keys and returns the number of keys that were
+// present and removed. Like PopMany, keys are grouped by shard and each shard is
+// write locked once.
+func (m *Map[K, V]) DeleteMany(keys []K) int {
+	m.checkWrite()
+	tab := m.holdTable()
+	defer m.layout.exit()
+	var n int
+	var removed []kv[K, V]
+	for shard, group := range tab.groupKeys(keys) {
+		if len(group) > 0 {
+			removed = m.removeShard(tab, shard, group, removed[:0])
+			n += len(removed)
+		}
+	}
+	return n
+}
+
+// RemoveAllFrom deletes every key of other from m and returns the number of
+// entries that were deleted. The values in other do not matter, so other acts as a
+// set of keys to remove, such as the removed side of a diff.
+//
+// other is walked shard by shard: the keys of a shard are copied under its read
+// lock, which is released before the matching keys are deleted from m with one
+// write lock per shard of m they fall in. No two locks are held at once, so m and
+// other may be used concurrently, but keys added to other during the call may or
+// may not be removed. When m and other have the same layout (see LoadParallel)
+// each shard of other maps to a single shard of m.
+func (m *Map[K, V]) RemoveAllFrom(other *Map[K, V]) int {
+	m.checkWrite()
+	tab := m.holdTable()
+	defer m.layout.exit()
+	otherTab := other.table()
+	aligned := tab.aligned(otherTab)
+	var n int
+	var keys []K
+	var removed []kv[K, V]
+	for i := 0; i < otherTab.shards; i++ {
+		keys = otherTab.appendKeys(keys[:0], i)
+		if len(keys) == 0 {
+			continue
+		}
+		if aligned {
+			removed = m.removeShard(tab, i, keys, removed[:0])
+			n += len(removed)
+			continue
+		}
+		for shard, group := range tab.groupKeys(keys) {
+			if len(group) > 0 {
+				removed = m.removeShard(tab, shard, group, removed[:0])
+				n += len(removed)
+			}
+		}
+	}
+	return n
+}
+
+// TransformValues replaces the value of every entry with fn(key, value), in place:
+// keys are not changed and no shard is reallocated. Each shard is write locked
+// while fn is applied to its entries, so readers of that shard wait until it is
+// done, and fn must not call into the map. Subscribers and the eviction handler
+// see every rewritten entry as a Set that replaced the old value.
+func (m *Map[K, V]) TransformValues(fn func(key K, value V) V) {
+	m.checkWrite()
+	tab := m.holdTable()
+	defer m.layout.exit()
+	var replaced []stored[K, V]
+	for i := 0; i < tab.shards; i++ {
+		replaced = replaced[:0]
+		func() {
+			tab.mus[i].Lock()
+			defer tab.mus[i].Unlock()
+			tab.grown[i] = nil
+			tab.maps[i].Update(func(key K, value V) V {
+				nv := fn(key, value)
+				if tab.bytes != nil {
+					tab.bytes[i].Add(m.sizeOf(key, nv) - m.sizeOf(key, value))
+				}
+				m.publish(Change[K, V]{Key: key, Value: nv})
+				m.storedLocked(tab, i, key)
+				if m.onEvict != nil || m.onSet != nil {
+					replaced = append(replaced, stored[K, V]{key, nv, value, true})
+				}
+				return nv
+			})
+		}()
+		for _, e := range replaced {
+			m.afterSet(e.key, e.value, e.prev, true)
+		}
+		if tab.bytes != nil {
+			m.trimShard(tab, i)
+		}
+	}
+}
+
+// groupKeys returns keys grouped by the index of their shard.
+func (t *table[K, V]) groupKeys(keys []K) [][]K {
+	groups := make([][]K, t.shards)
+	for _, key := range keys {
+		shard := t.choose(key)
+		groups[shard] = append(groups[shard], key)
+	}
+	return groups
+}
+
+// removeShard deletes keys, which must all belong to shard, under a single lock
+// and appends the removed entries to buf.
+func (m *Map[K, V]) removeShard(tab *table[K, V], shard int, keys []K, buf []kv[K, V]) []kv[K, V] {
+	start := len(buf)
+	tab.mus[shard].Lock()
+	for _, key := range keys {
+		if prev, ok := m.deleteLocked(tab, shard, key); ok {
+			buf = append(buf, kv[K, V]{key, prev})
+		}
+	}
+	tab.mus[shard].Unlock()
+	for _, e := range buf[start:] {
+		m.afterDelete(e.key, e.value)
+	}
+	return buf
+}
+
+// appendShard appends the entries of shard to buf under the shard's read lock.
+func (t *table[K, V]) appendShard(buf []kv[K, V], shard int) []kv[K, V] {
+	t.mus[shard].RLock()
+	defer t.mus[shard].RUnlock()
+	for k, v := range t.maps[shard].All() {
+		buf = append(buf, kv[K, V]{k, v})
+	}
+	return buf
+}
+
+// appendKeys appends the keys of shard to buf under the shard's read lock.
+func (t *table[K, V]) appendKeys(buf []K, shard int) []K {
+	t.mus[shard].RLock()
+	defer t.mus[shard].RUnlock()
+	for k := range t.maps[shard].AllKeys() {
+		buf = append(buf, k)
+	}
+	return buf
+}
+
+// loadShard sets entries, which must all belong to shard, under a single lock. If
+// combine is not nil the stored value is combine(current, exists, entry value),
+// where current is the zero value for an absent key.
+func (m *Map[K, V]) loadShard(tab *table[K, V], shard int, entries []kv[K, V], combine func(cur V, exists bool, v V) V) {
+	hooked := m.onSet != nil || m.onEvict != nil
+	var done []stored[K, V]
+	var inserted bool
+	func() {
+		tab.mus[shard].Lock()
+		defer tab.mus[shard].Unlock()
+		for _, e := range entries {
+			if m.interner != nil {
+				e.key = m.interner.intern(e.key)
+			}
+			if combine != nil {
+				cur, exists := tab.maps[shard].Get(e.key)
+				e.value = combine(cur, exists, e.value)
+			}
+			prev, replaced := m.setLocked(tab, shard, e.key, e.value)
+			if hooked {
+				done = append(done, stored[K, V]{e.key, e.value, prev, replaced})
+			}
+			inserted = inserted || !replaced
+		}
+	}()
+	for _, s := range done {
+		m.notifySet(s.key, s.value, s.prev, s.replaced)
+	}
+	if m.overflows(!inserted) {
+		m.trimShard(tab, shard)
+	}
+}
@@ -0,0 +1,375 @@
+package shardmap
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadParallel(t *testing.T) {
+	src := New[string, int](0)
+	for i := 0; i < 10000; i++ {
+		src.Set(k(i), i)
+	}
+
+	tests := []struct {
+		name    string
+		dst     *Map[string, int]
+		aligned bool
+	}{
+		{"aligned", src.NewLike(), true},
+		{"general", New[string, int](0), false},
+	}
+	for _, test := range tests {
+		test.dst.Set(k(1), -1)
+		test.dst.Set("extra", -1)
+		if got := test.dst.table().aligned(src.table()); got != test.aligned {
+			t.Fatalf("%s: expected aligned %v, got %v", test.name, test.aligned, got)
+		}
+		test.dst.LoadParallel(src, 4)
+		if test.dst.Len() != 10001 {
+			t.Fatalf("%s: expected %v, got %v", test.name, 10001, test.dst.Len())
+		}
+		for i := 0; i < 10000; i++ {
+			if v, ok := test.dst.Get(k(i)); !ok || v != i {
+				t.Fatalf("%s: expected %v, got %v", test.name, i, v)
+			}
+		}
+	}
+}
+
+func TestApplyDelta(t *testing.T) {
+	sum := func(cur, delta int) int { return cur + delta }
+
+	m := New[string, int](0)
+	m.Set("a", 1)
+	m.Set("b", 2)
+
+	aligned := m.NewLike()
+	aligned.Set("a", 10)
+	aligned.Set("c", 30)
+	general := New[string, int](0)
+	general.Set("b", 20)
+	general.Set("c", 300)
+
+	m.ApplyDelta(aligned, sum)
+	m.ApplyDelta(general, sum)
+	for key, want := range map[string]int{"a": 11, "b": 22, "c": 330} {
+		if v, _ := m.Get(key); v != want {
+			t.Fatalf("%s: expected %v, got %v", key, want, v)
+		}
+	}
+	if m.Len() != 3 {
+		t.Fatalf("expected %v, got %v", 3, m.Len())
+	}
+	if aligned.Len() != 2 || general.Len() != 2 {
+		t.Fatal("delta maps must not be modified")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	other := New[string, int](0)
+	for i := 0; i < 100; i++ {
+		other.Set(k(i), i)
+	}
+	tests := []struct {
+		name       string
+		onConflict func(existing, incoming int) int
+		want       func(existing, incoming int) int
+	}{
+		{"overwrite", nil, func(_, incoming int) int { return incoming }},
+		{"keep", func(existing, _ int) int { return existing }, func(existing, _ int) int { return existing }},
+		{"sum", func(existing, incoming int) int { return existing + incoming }, func(existing, incoming int) int { return existing + incoming }},
+	}
+	for _, test := range tests {
+		for _, m := range []*Map[string, int]{New[string, int](0), other.NewLike()} {
+			for i := 50; i < 150; i++ {
+				m.Set(k(i), 1000)
+			}
+			m.Merge(other, test.onConflict)
+			if m.Len() != 150 {
+				t.Fatalf("%s: expected %v, got %v", test.name, 150, m.Len())
+			}
+			for i := 0; i < 150; i++ {
+				want := i
+				switch {
+				case i >= 100:
+					want = 1000
+				case i >= 50:
+					want = test.want(1000, i)
+				}
+				if v, _ := m.Get(k(i)); v != want {
+					t.Fatalf("%s: key %v: expected %v, got %v", test.name, k(i), want, v)
+				}
+			}
+		}
+	}
+}
+
+func TestSetMany(t *testing.T) {
+	var m Map[string, int]
+	m.Set(k(1), -1)
+	m.Set("other", -1)
+	entries := map[string]int{}
+	for i := 0; i < 10000; i++ {
+		entries[k(i)] = i
+	}
+	m.SetMany(entries)
+	if m.Len() != 10001 {
+		t.Fatalf("expected %v, got %v", 10001, m.Len())
+	}
+	for i := 0; i < 10000; i++ {
+		if v, ok := m.Get(k(i)); !ok || v != i {
+			t.Fatalf("key %v: expected %v, got %v", k(i), i, v)
+		}
+	}
+	if v, _ := m.Get("other"); v != -1 {
+		t.Fatalf("expected %v, got %v", -1, v)
+	}
+	m.SetMany(nil)
+	if m.Len() != 10001 {
+		t.Fatalf("expected %v, got %v", 10001, m.Len())
+	}
+}
+
+func TestGetMany(t *testing.T) {
+	var m Map[string, int]
+	for i := 0; i < 1000; i++ {
+		m.Set(k(i), i)
+	}
+	var keys []string
+	for i := 500; i < 1500; i++ {
+		keys = append(keys, k(i))
+	}
+	got := m.GetMany(keys)
+	if len(got) != 500 {
+		t.Fatalf("expected %v, got %v", 500, len(got))
+	}
+	for i := 500; i < 1500; i++ {
+		v, ok := got[k(i)]
+		if ok != (i < 1000) {
+			t.Fatalf("key %v: expected present %v, got %v", k(i), i < 1000, ok)
+		}
+		if ok && v != i {
+			t.Fatalf("key %v: expected %v, got %v", k(i), i, v)
+		}
+	}
+	if got := m.GetMany(nil); len(got) != 0 {
+		t.Fatalf("expected %v, got %v", 0, len(got))
+	}
+}
+
+func TestPopMany(t *testing.T) {
+	var m Map[int, int]
+	for i := 0; i < 100; i++ {
+		m.Set(i, i*10)
+	}
+	got := m.PopMany([]int{1, 2, 3, 1000, 2})
+	if len(got) != 3 {
+		t.Fatalf("expected %v, got %v", 3, len(got))
+	}
+	for _, key := range []int{1, 2, 3} {
+		if got[key] != key*10 {
+			t.Fatalf("expected %v, got %v", key*10, got[key])
+		}
+		if _, ok := m.Get(key); ok {
+			t.Fatalf("expected %v to be removed", key)
+		}
+	}
+	if m.Len() != 97 {
+		t.Fatalf("expected %v, got %v", 97, m.Len())
+	}
+}
+
+func TestPopManyConcurrent(t *testing.T) {
+	var m Map[int, int]
+	keys := make([]int, 1000)
+	for i := range keys {
+		keys[i] = i
+		m.Set(i, i)
+	}
+	results := make(chan map[int]int)
+	for w := 0; w < 8; w++ {
+		go func() {
+			results <- m.PopMany(keys)
+		}()
+	}
+	seen := map[int]bool{}
+	for w := 0; w < 8; w++ {
+		for key := range <-results {
+			if seen[key] {
+				t.Fatalf("key %v popped twice", key)
+			}
+			seen[key] = true
+		}
+	}
+	if len(seen) != 1000 {
+		t.Fatalf("expected %v, got %v", 1000, len(seen))
+	}
+}
+
+func TestDeleteMany(t *testing.T) {
+	var m Map[string, int]
+	for i := 0; i < 1000; i++ {
+		m.Set(k(i), i)
+	}
+	var keys []string
+	for i := 500; i < 1500; i++ {
+		keys = append(keys, k(i))
+	}
+	if n := m.DeleteMany(keys); n != 500 {
+		t.Fatalf("expected %v, got %v", 500, n)
+	}
+	if m.Len() != 500 {
+		t.Fatalf("expected %v, got %v", 500, m.Len())
+	}
+	for i := 0; i < 1000; i++ {
+		if _, ok := m.Get(k(i)); ok != (i < 500) {
+			t.Fatalf("key %v: expected present %v, got %v", k(i), i < 500, ok)
+		}
+	}
+	if n := m.DeleteMany(keys); n != 0 {
+		t.Fatalf("expected %v, got %v", 0, n)
+	}
+}
+
+func TestTransformValues(t *testing.T) {
+	var replaced int
+	m := New[string, string](0, WithEvictionHandler(func(_ string, _ string, reason EvictReason) {
+		if reason == EvictReplaced {
+			replaced++
+		}
+	}))
+	for i := 0; i < 1000; i++ {
+		m.Set(k(i), " "+k(i)+" ")
+	}
+	m.TransformValues(func(_ string, value string) string {
+		return strings.TrimSpace(value)
+	})
+	if m.Len() != 1000 {
+		t.Fatalf("expected %v, got %v", 1000, m.Len())
+	}
+	for i := 0; i < 1000; i++ {
+		if v, _ := m.Get(k(i)); v != k(i) {
+			t.Fatalf("expected %q, got %q", k(i), v)
+		}
+	}
+	if replaced != 1000 {
+		t.Fatalf("expected %v, got %v", 1000, replaced)
+	}
+}
+
+func TestRemoveAllFrom(t *testing.T) {
+	tests := []struct {
+		name  string
+		other func(m *Map[int, int]) *Map[int, int]
+	}{
+		{"aligned", (*Map[int, int]).NewLike},
+		{"general", func(*Map[int, int]) *Map[int, int] { return New[int, int](0) }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var m Map[int, int]
+			for i := 0; i < 1000; i++ {
+				m.Set(i, i)
+			}
+			other := test.other(&m)
+			for i := 0; i < 1000; i += 2 {
+				other.Set(i, -1)
+			}
+			other.Set(5000, -1)
+			if got := m.RemoveAllFrom(other); got != 500 {
+				t.Fatalf("expected %v, got %v", 500, got)
+			}
+			if m.Len() != 500 {
+				t.Fatalf("expected %v, got %v", 500, m.Len())
+			}
+			for i := 0; i < 1000; i++ {
+				if _, ok := m.Get(i); ok != (i%2 == 1) {
+					t.Fatalf("key %v: expected present %v, got %v", i, i%2 == 1, ok)
+				}
+			}
+			if other.Len() != 501 {
+				t.Fatalf("expected %v, got %v", 501, other.Len())
+			}
+		})
+	}
+}
+
+func BenchmarkSetMany(b *testing.B) {
+	entries := map[string]int{}
+	for i := 0; i < 10000; i++ {
+		entries[k(i)] = i
+	}
+
+	b.Run("SetMany", func(b *testing.B) {
+		var m Map[string, int]
+		for i := 0; i < b.N; i++ {
+			m.SetMany(entries)
+		}
+	})
+	b.Run("SetLoop", func(b *testing.B) {
+		var m Map[string, int]
+		for i := 0; i < b.N; i++ {
+			for k, v := range entries {
+				m.Set(k, v)
+			}
+		}
+	})
+}
+
+func BenchmarkGetMany(b *testing.B) {
+	var m Map[string, int]
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = k(i)
+		m.Set(keys[i], i)
+	}
+
+	b.Run("GetMany", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			m.GetMany(keys)
+		}
+	})
+	b.Run("GetLoop", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			out := make(map[string]int, len(keys))
+			for _, key := range keys {
+				if v, ok := m.Get(key); ok {
+					out[key] = v
+				}
+			}
+		}
+	})
+}
+
+func BenchmarkDeleteMany(b *testing.B) {
+	var m Map[string, int]
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = k(i)
+	}
+	fill := func() {
+		for i, key := range keys {
+			m.Set(key, i)
+		}
+	}
+
+	b.Run("DeleteMany", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			fill()
+			b.StartTimer()
+			m.DeleteMany(keys)
+		}
+	})
+	b.Run("DeleteLoop", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			fill()
+			b.StartTimer()
+			for _, key := range keys {
+				m.Delete(key)
+			}
+		}
+	})
+}
@@ -0,0 +1,38 @@
+package shardmap
+
+// WithMaxBytes bounds a map of byte slices to about n bytes for use as a blob
+// cache, where the values vary too much in size for WithMaxEntries to bound its
+// memory. The size of an entry is len(key) + len(value), kept up to date by every
+// store and delete. When a store takes a shard over its share of n, the shard's
+// least recently used entries are deleted, like with WithMaxEntries, and the
+// eviction handler is called for them with EvictOverflow. The two options can be
+// combined, and the first bound reached evicts.
+//
+// The accounting is approximate: it counts what the keys and values hold, not the
+// memory of the map itself, the slice headers or the spare capacity of a value
+// (cap(value) - len(value)), and a value sharing its backing array with others is
+// counted in full. Like the bound on entries it is applied per shard, each shard
+// holding n divided by the shard count (rounded up), so an entry larger than that
+// share is evicted right after it was stored. Bytes reports the tracked total.
+func WithMaxBytes(n int64) Option[string, []byte] {
+	return func(m *Map[string, []byte]) {
+		m.maxBytes = max(n, 0)
+		m.sizeOf = func(key string, value []byte) int64 {
+			return int64(len(key) + len(value))
+		}
+	}
+}
+
+// Bytes returns the size of the entries tracked for WithMaxBytes, summed over the
+// shards without locking them like Len. It returns 0 for a map without the option.
+func (m *Map[K, V]) Bytes() int64 {
+	tab := m.table()
+	if tab.bytes == nil {
+		return 0
+	}
+	var n int64
+	for i := range tab.bytes {
+		n += tab.bytes[i].Load()
+	}
+	return n
+}
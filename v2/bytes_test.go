@@ -0,0 +1,176 @@
+package shardmap
+
+import (
+	"bytes"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMaxBytes(t *testing.T) {
+	var evicted []string
+	m := New[string, []byte](0,
+		WithShards[string, []byte](1),
+		WithMaxBytes(100),
+		WithEvictionHandler(func(key string, value []byte, reason EvictReason) {
+			if reason == EvictOverflow {
+				evicted = append(evicted, key)
+			}
+		}),
+	)
+	m.Set("a", make([]byte, 29))
+	m.Set("b", make([]byte, 29))
+	m.Set("c", make([]byte, 9))
+	if m.Bytes() != 70 || len(evicted) != 0 {
+		t.Fatalf("expected %v bytes and no evictions, got %v and %v", 70, m.Bytes(), evicted)
+	}
+
+	// replacing a value with a larger one can evict, and a is used again
+	m.Get("a")
+	m.Set("c", make([]byte, 49))
+	if m.Bytes() != 80 || len(evicted) != 1 || evicted[0] != "b" {
+		t.Fatalf("expected %v bytes with b evicted, got %v and %v", 80, m.Bytes(), evicted)
+	}
+	m.Set("c", nil)
+	if m.Bytes() != 31 {
+		t.Fatalf("expected %v, got %v", 31, m.Bytes())
+	}
+	m.Delete("a")
+	if m.Bytes() != 1 {
+		t.Fatalf("expected %v, got %v", 1, m.Bytes())
+	}
+
+	// an entry larger than the budget does not stay
+	m.Set("huge", make([]byte, 200))
+	if m.Contains("huge") || m.Len() != 0 || m.Bytes() != 0 {
+		t.Fatalf("expected an empty map, got Len %v with %v bytes", m.Len(), m.Bytes())
+	}
+
+	m.SetMany(map[string][]byte{"d": make([]byte, 59), "e": make([]byte, 59)})
+	if m.Len() != 1 || m.Bytes() != 60 {
+		t.Fatalf("expected %v entry of %v bytes, got %v of %v", 1, 60, m.Len(), m.Bytes())
+	}
+	m.TransformValues(func(key string, value []byte) []byte { return value[:9] })
+	if m.Bytes() != 10 {
+		t.Fatalf("expected %v, got %v", 10, m.Bytes())
+	}
+	m.Clear()
+	if m.Bytes() != 0 {
+		t.Fatalf("expected %v, got %v", 0, m.Bytes())
+	}
+	m.Set("f", []byte("x"))
+	m.ResetKeep()
+	if m.Bytes() != 0 {
+		t.Fatalf("expected %v, got %v", 0, m.Bytes())
+	}
+
+	var plain Map[string, []byte]
+	plain.Set("a", []byte("x"))
+	if plain.Bytes() != 0 {
+		t.Fatalf("expected %v, got %v", 0, plain.Bytes())
+	}
+}
+
+func TestMaxBytesSharded(t *testing.T) {
+	m := New[string, []byte](0, WithShards[string, []byte](4), WithMaxBytes(10000))
+	value := bytes.Repeat([]byte("v"), 96)
+	for i := 0; i < 1000; i++ {
+		m.Set(k(i), value)
+	}
+	tab := m.table()
+	if tab.byteCap != 2500 {
+		t.Fatalf("expected %v, got %v", 2500, tab.byteCap)
+	}
+	var sum int64
+	for i := range tab.bytes {
+		if n := tab.bytes[i].Load(); n > tab.byteCap {
+			t.Fatalf("shard %d: expected at most %v bytes, got %v", i, tab.byteCap, n)
+		}
+		var want int64
+		for key, value := range tab.maps[i].All() {
+			want += int64(len(key) + len(value))
+		}
+		if n := tab.bytes[i].Load(); n != want {
+			t.Fatalf("shard %d: expected %v bytes, got %v", i, want, n)
+		}
+		sum += want
+	}
+	if m.Bytes() != sum {
+		t.Fatalf("expected %v, got %v", sum, m.Bytes())
+	}
+
+	// the sizes are carried to the new shards
+	m.Resize(2)
+	if m.Bytes() != sum {
+		t.Fatalf("expected %v, got %v", sum, m.Bytes())
+	}
+	if c := m.Clone(); c.Bytes() != sum {
+		t.Fatalf("expected the clone to hold %v bytes, got %v", sum, c.Bytes())
+	}
+
+	// more shards give each a smaller share, which Resize enforces right away
+	m.Resize(16)
+	tab = m.table()
+	sum = 0
+	for i := range tab.bytes {
+		var want int64
+		for key, value := range tab.maps[i].All() {
+			want += int64(len(key) + len(value))
+		}
+		if n := tab.bytes[i].Load(); n != want || n > tab.byteCap {
+			t.Fatalf("shard %d: expected %v bytes, at most %v, after Resize, got %v", i, want, tab.byteCap, n)
+		}
+		sum += want
+	}
+	if m.Bytes() != sum {
+		t.Fatalf("expected %v, got %v", sum, m.Bytes())
+	}
+}
+
+func TestMaxBytesWithMaxEntries(t *testing.T) {
+	m := New[string, []byte](0,
+		WithShards[string, []byte](1),
+		WithMaxBytes(1000),
+		WithMaxEntries[string, []byte](2),
+	)
+	m.Set("a", []byte("1"))
+	m.Set("b", []byte("2"))
+	m.Set("c", []byte("3"))
+	if m.Len() != 2 || m.Contains("a") {
+		t.Fatalf("expected the entry bound to evict a, got Len %v", m.Len())
+	}
+	m.Set("d", make([]byte, 999))
+	if m.Len() != 1 || !m.Contains("d") {
+		t.Fatalf("expected the byte bound to leave only d, got Len %v", m.Len())
+	}
+}
+
+func TestMaxBytesConcurrent(t *testing.T) {
+	var evicted atomic.Int64
+	m := New[string, []byte](0,
+		WithShards[string, []byte](4),
+		WithMaxBytes(4000),
+		WithEvictionHandler(func(key string, value []byte, reason EvictReason) {
+			evicted.Add(1)
+		}),
+	)
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				key := k(w*1000 + i)
+				m.Set(key, make([]byte, i%100))
+				m.Get(key)
+			}
+		}(w)
+	}
+	wg.Wait()
+	if m.Bytes() > 4000 {
+		t.Fatalf("expected at most %v bytes, got %v", 4000, m.Bytes())
+	}
+	if got := evicted.Load() + int64(m.Len()); got != 4000 {
+		t.Fatalf("expected %v entries stored, got %v", 4000, got)
+	}
+}
@@ -0,0 +1,101 @@
+package shardmap
+
+// CompareAndSwapFunc stores new for key if key is present and eq reports true for
+// its current value, and returns whether it did. An absent key is never swapped
+// and eq is not called for it. This is CompareAndSwap for value types that cannot
+// be compared with ==.
+//
+// The compare and the store happen under a single hold of the key's shard write
+// lock, so eq must be quick and must not call into the map.
+func (m *Map[K, V]) CompareAndSwapFunc(key K, new V, eq func(current V) bool) bool {
+	m.checkWrite()
+	var prev V
+	var swapped bool
+	func() {
+		tab, shard := m.lockKey(key)
+		defer tab.mus[shard].Unlock()
+		cur, ok := tab.maps[shard].Get(key)
+		if !ok || !eq(cur) {
+			return
+		}
+		prev, _ = m.setLocked(tab, shard, key, new)
+		swapped = true
+	}()
+	if swapped {
+		m.afterSet(key, new, prev, true)
+	}
+	return swapped
+}
+
+// CompareAndSwap stores new for key if key is present and its value is equal to
+// old, and returns whether it did, like sync.Map's CompareAndSwap. It is a function
+// rather than a method because it needs V to be comparable; see
+// CompareAndSwapFunc for other value types.
+func CompareAndSwap[K, V comparable](m *Map[K, V], key K, old, new V) bool {
+	return m.CompareAndSwapFunc(key, new, func(current V) bool { return current == old })
+}
+
+// CompareAndDeleteFunc deletes key if it is present and eq reports true for its
+// current value, and returns whether it did. Like CompareAndSwapFunc, the compare
+// and the delete happen under a single hold of the key's shard write lock.
+func (m *Map[K, V]) CompareAndDeleteFunc(key K, eq func(current V) bool) bool {
+	m.checkWrite()
+	var prev V
+	var deleted bool
+	func() {
+		tab, shard := m.lockKey(key)
+		defer tab.mus[shard].Unlock()
+		cur, ok := tab.maps[shard].Get(key)
+		if !ok || !eq(cur) {
+			return
+		}
+		prev, deleted = m.deleteLocked(tab, shard, key)
+	}()
+	if deleted {
+		m.afterDelete(key, prev)
+	}
+	return deleted
+}
+
+// CompareAndDelete deletes key if its value is equal to old, and returns whether
+// it did, like sync.Map's CompareAndDelete. A deleter holding a stale value can
+// therefore not remove a newer one.
+func CompareAndDelete[K, V comparable](m *Map[K, V], key K, old V) bool {
+	return m.CompareAndDeleteFunc(key, func(current V) bool { return current == old })
+}
+
+// Equal reports whether m and other hold the same keys, with eq reporting true for
+// the values of each key. It compares Len first, then looks up every entry of m in
+// other.
+//
+// m is copied one shard at a time under the shard's read lock, and the lookups in
+// other are done after that lock is released, so no lock of one map is held while
+// one of the other is taken and two Equal calls in opposite directions cannot
+// deadlock. The price is that the result is only exact if neither map is modified
+// during the call.
+func (m *Map[K, V]) Equal(other *Map[K, V], eq func(a, b V) bool) bool {
+	if m == other {
+		return true
+	}
+	if m.Len() != other.Len() {
+		return false
+	}
+	tab := m.table()
+	var buf []kv[K, V]
+	for i := 0; i < tab.shards; i++ {
+		buf = tab.appendShard(buf[:0], i)
+		for _, e := range buf {
+			v, ok := other.Get(e.key)
+			if !ok || !eq(e.value, v) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// EqualComparable is Equal with values compared using ==. It is a function rather
+// than a method because it needs V to be comparable.
+func EqualComparable[K, V comparable](m, other *Map[K, V]) bool {
+	return m.Equal(other, func(a, b V) bool { return a == b })
+}
@@ -0,0 +1,162 @@
+package shardmap
+
+import (
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestCompareAndSwap(t *testing.T) {
+	var m Map[string, int]
+	if CompareAndSwap(&m, "a", 0, 1) {
+		t.Fatal("expected an absent key to not be swapped")
+	}
+	if _, ok := m.Get("a"); ok {
+		t.Fatal("expected a to not be stored")
+	}
+	m.Set("a", 1)
+	if CompareAndSwap(&m, "a", 2, 3) {
+		t.Fatal("expected a mismatch to not be swapped")
+	}
+	if !CompareAndSwap(&m, "a", 1, 2) {
+		t.Fatal("expected a swap")
+	}
+	if v, _ := m.Get("a"); v != 2 {
+		t.Fatalf("expected %v, got %v", 2, v)
+	}
+
+	// concurrent increments through CompareAndSwap lose nothing
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				for {
+					v, _ := m.Get("a")
+					if CompareAndSwap(&m, "a", v, v+1) {
+						break
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if v, _ := m.Get("a"); v != 802 {
+		t.Fatalf("expected %v, got %v", 802, v)
+	}
+}
+
+func TestCompareAndSwapFunc(t *testing.T) {
+	var m Map[string, []int]
+	m.Set("a", []int{1, 2})
+	if m.CompareAndSwapFunc("a", []int{3}, func(cur []int) bool { return slices.Equal(cur, []int{1}) }) {
+		t.Fatal("expected a mismatch to not be swapped")
+	}
+	if !m.CompareAndSwapFunc("a", []int{3}, func(cur []int) bool { return slices.Equal(cur, []int{1, 2}) }) {
+		t.Fatal("expected a swap")
+	}
+	if v, _ := m.Get("a"); !slices.Equal(v, []int{3}) {
+		t.Fatalf("expected %v, got %v", []int{3}, v)
+	}
+	called := false
+	if m.CompareAndSwapFunc("b", nil, func([]int) bool { called = true; return true }) || called {
+		t.Fatal("expected eq to not be called for an absent key")
+	}
+}
+
+func TestCompareAndDelete(t *testing.T) {
+	var m Map[string, int]
+	if CompareAndDelete(&m, "a", 0) {
+		t.Fatal("expected an absent key to not be deleted")
+	}
+	m.Set("a", 1)
+	seen, _ := m.Get("a")
+	// the value changes between the read and the delete
+	m.Set("a", 2)
+	if CompareAndDelete(&m, "a", seen) {
+		t.Fatal("expected a stale value to not delete")
+	}
+	if v, ok := m.Get("a"); !ok || v != 2 {
+		t.Fatalf("expected %v, got %v", 2, v)
+	}
+	if !CompareAndDelete(&m, "a", 2) {
+		t.Fatal("expected a delete")
+	}
+	if _, ok := m.Get("a"); ok || m.Len() != 0 {
+		t.Fatal("expected a to be deleted")
+	}
+
+	var n Map[string, []int]
+	n.Set("a", []int{1})
+	if n.CompareAndDeleteFunc("a", func(cur []int) bool { return len(cur) == 0 }) {
+		t.Fatal("expected a mismatch to not delete")
+	}
+	if !n.CompareAndDeleteFunc("a", func(cur []int) bool { return len(cur) == 1 }) {
+		t.Fatal("expected a delete")
+	}
+}
+
+func TestEqual(t *testing.T) {
+	a, b := New[string, int](0), New[string, int](0, WithShards[string, int](2))
+	if !EqualComparable(a, b) {
+		t.Fatal("expected empty maps to be equal")
+	}
+	for i := 0; i < 1000; i++ {
+		a.Set(k(i), i)
+		b.Set(k(i), i)
+	}
+	if !EqualComparable(a, b) || !EqualComparable(b, a) || !EqualComparable(a, a) {
+		t.Fatal("expected equal maps")
+	}
+
+	// one value differs
+	b.Set(k(500), -1)
+	if EqualComparable(a, b) || EqualComparable(b, a) {
+		t.Fatal("expected maps differing by a value to not be equal")
+	}
+	if !a.Equal(b, func(x, y int) bool { return x == y || y == -1 }) {
+		t.Fatal("expected eq to decide")
+	}
+	b.Set(k(500), 500)
+
+	// one key differs, with the same Len
+	b.Delete(k(500))
+	b.Set("other", 500)
+	if EqualComparable(a, b) || EqualComparable(b, a) {
+		t.Fatal("expected maps differing by a key to not be equal")
+	}
+	b.Delete("other")
+	if EqualComparable(a, b) {
+		t.Fatal("expected maps of different lengths to not be equal")
+	}
+}
+
+func TestEqualConcurrent(t *testing.T) {
+	a, b := New[int, int](0), New[int, int](0)
+	for i := 0; i < 1000; i++ {
+		a.Set(i, i)
+		b.Set(i, i)
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				// opposite directions plus writers must not deadlock
+				if w%2 == 0 {
+					EqualComparable(a, b)
+					a.Set(i, i)
+				} else {
+					EqualComparable(b, a)
+					b.Set(i, i)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	if !EqualComparable(a, b) {
+		t.Fatal("expected equal maps")
+	}
+}
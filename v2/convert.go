@@ -0,0 +1,89 @@
+package shardmap
+
+// ToMapFunc returns a plain map holding the entries for which keep returns true.
+// Each shard is walked under its read lock, so keep must not write to the map, and
+// the result is consistent per shard but not across shards. The result is sized
+// for a quarter of the map, as the fraction keep selects is not known up front.
+func (m *Map[K, V]) ToMapFunc(keep func(key K, value V) bool) map[K]V {
+	tab := m.table()
+	out := make(map[K]V, m.Len()/4)
+	for i := 0; i < tab.shards; i++ {
+		func() {
+			tab.mus[i].RLock()
+			defer tab.mus[i].RUnlock()
+			for k, v := range tab.maps[i].All() {
+				if keep(k, v) {
+					out[k] = v
+				}
+			}
+		}()
+	}
+	return out
+}
+
+// Snapshot returns a plain map holding every entry, which the caller can iterate
+// and modify freely while the Map keeps changing. Each shard is copied under its
+// read lock in turn, so the snapshot is consistent per shard but not across shards:
+// it may include a write to one shard and miss an earlier write to another. The
+// copy costs memory proportional to the map.
+func (m *Map[K, V]) Snapshot() map[K]V {
+	tab := m.table()
+	out := make(map[K]V, m.Len())
+	for i := 0; i < tab.shards; i++ {
+		func() {
+			tab.mus[i].RLock()
+			defer tab.mus[i].RUnlock()
+			for k, v := range tab.maps[i].All() {
+				out[k] = v
+			}
+		}()
+	}
+	return out
+}
+
+// ToMap returns every entry as a plain map. It is Snapshot, under the name that
+// pairs with FromMap.
+func (m *Map[K, V]) ToMap() map[K]V {
+	return m.Snapshot()
+}
+
+// FromMap returns a new Map holding the entries of src, created with a capacity of
+// len(src) so the shards rarely have to grow while it is filled. The entries are
+// copied: later changes to src do not affect the result.
+func FromMap[K comparable, V any](src map[K]V, opts ...Option[K, V]) *Map[K, V] {
+	m := New(len(src), opts...)
+	m.SetMany(src)
+	return m
+}
+
+// Keys returns every key in the map. Each shard's keys are copied under its read
+// lock and no lock is held across shards, so the result is a snapshot of each
+// shard at a slightly different moment rather than of the whole map at once. The
+// result is preallocated from Len.
+func (m *Map[K, V]) Keys() []K {
+	tab := m.table()
+	keys := make([]K, 0, m.Len())
+	for i := 0; i < tab.shards; i++ {
+		keys = tab.appendKeys(keys, i)
+	}
+	return keys
+}
+
+// Values returns every value in the map, with a value stored under several keys
+// appearing once per key. Like Keys, each shard is copied under its read lock and
+// the result is not a snapshot of the whole map at one moment. An empty map
+// returns an empty, non-nil slice.
+func (m *Map[K, V]) Values() []V {
+	tab := m.table()
+	values := make([]V, 0, m.Len())
+	for i := 0; i < tab.shards; i++ {
+		func() {
+			tab.mus[i].RLock()
+			defer tab.mus[i].RUnlock()
+			for _, v := range tab.maps[i].All() {
+				values = append(values, v)
+			}
+		}()
+	}
+	return values
+}
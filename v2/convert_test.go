@@ -0,0 +1,133 @@
+package shardmap
+
+import (
+	"bytes"
+	"maps"
+	"testing"
+)
+
+func TestToMapFunc(t *testing.T) {
+	var m Map[int, int]
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i*10)
+	}
+	got := m.ToMapFunc(func(key, value int) bool { return key%2 == 0 })
+	if len(got) != 500 {
+		t.Fatalf("expected %v, got %v", 500, len(got))
+	}
+	for i := 0; i < 1000; i += 2 {
+		if got[i] != i*10 {
+			t.Fatalf("expected %v, got %v", i*10, got[i])
+		}
+	}
+	if got := m.ToMapFunc(func(int, int) bool { return false }); len(got) != 0 {
+		t.Fatalf("expected %v, got %v", 0, len(got))
+	}
+}
+
+func TestKeys(t *testing.T) {
+	var m Map[string, int]
+	if keys := m.Keys(); len(keys) != 0 {
+		t.Fatalf("expected %v, got %v", 0, len(keys))
+	}
+	for i := 0; i < 1000; i++ {
+		m.Set(k(i), i)
+	}
+	keys := m.Keys()
+	if len(keys) != 1000 {
+		t.Fatalf("expected %v, got %v", 1000, len(keys))
+	}
+	seen := map[string]bool{}
+	for _, key := range keys {
+		seen[key] = true
+	}
+	for i := 0; i < 1000; i++ {
+		if !seen[k(i)] {
+			t.Fatalf("expected key %v", k(i))
+		}
+	}
+}
+
+func TestValues(t *testing.T) {
+	var m Map[string, int]
+	if values := m.Values(); values == nil || len(values) != 0 {
+		t.Fatalf("expected an empty non-nil slice, got %#v", values)
+	}
+	for i := 0; i < 1000; i++ {
+		m.Set(k(i), i%10)
+	}
+	values := m.Values()
+	if len(values) != 1000 {
+		t.Fatalf("expected %v, got %v", 1000, len(values))
+	}
+	counts := map[int]int{}
+	for _, v := range values {
+		counts[v]++
+	}
+	for i := 0; i < 10; i++ {
+		if counts[i] != 100 {
+			t.Fatalf("value %v: expected %v, got %v", i, 100, counts[i])
+		}
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	var m Map[string, int]
+	for i := 0; i < 1000; i++ {
+		m.Set(k(i), i)
+	}
+	snap := m.Snapshot()
+	m.Set(k(0), -1)
+	m.Delete(k(1))
+	m.Set("new", 1)
+	if len(snap) != 1000 {
+		t.Fatalf("expected %v, got %v", 1000, len(snap))
+	}
+	for i := 0; i < 1000; i++ {
+		if v, ok := snap[k(i)]; !ok || v != i {
+			t.Fatalf("key %v: expected %v, got %v", k(i), i, v)
+		}
+	}
+	if _, ok := snap["new"]; ok {
+		t.Fatal("expected the snapshot to not see later writes")
+	}
+	// writing to the snapshot does not change the map
+	snap[k(2)] = -2
+	if v, _ := m.Get(k(2)); v != 2 {
+		t.Fatalf("expected %v, got %v", 2, v)
+	}
+}
+
+func TestFromMap(t *testing.T) {
+	ints := map[int]int{}
+	strs := map[string][]byte{}
+	type point struct{ x, y int }
+	points := map[point]string{}
+	for i := 0; i < 1000; i++ {
+		ints[i] = -i
+		strs[k(i)] = []byte(k(i))
+		points[point{i, -i}] = k(i)
+	}
+	if got := FromMap(ints).ToMap(); !maps.Equal(got, ints) {
+		t.Fatalf("expected %v entries to round-trip, got %v", len(ints), len(got))
+	}
+	if got := FromMap(strs).ToMap(); !maps.EqualFunc(got, strs, bytes.Equal) {
+		t.Fatalf("expected %v entries to round-trip, got %v", len(strs), len(got))
+	}
+	if got := FromMap(points).ToMap(); !maps.Equal(got, points) {
+		t.Fatalf("expected %v entries to round-trip, got %v", len(points), len(got))
+	}
+	if got := FromMap(map[string]int{}).ToMap(); len(got) != 0 {
+		t.Fatalf("expected %v, got %v", 0, len(got))
+	}
+
+	m := FromMap(ints, WithShards[int, int](4))
+	if m.Cap() != len(ints) || m.Shards() != 4 {
+		t.Fatalf("expected cap %v and %v shards, got %v and %v", len(ints), 4, m.Cap(), m.Shards())
+	}
+	// the result does not share the source
+	ints[0] = 1
+	if v, _ := m.Get(0); v != 0 {
+		t.Fatalf("expected %v, got %v", 0, v)
+	}
+}
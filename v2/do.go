@@ -0,0 +1,66 @@
+package shardmap
+
+// Do runs fn under a single hold of key's shard write lock, for composite
+// operations on one key that none of the conditional methods (SetAccept,
+// DeleteAccept, Update, ...) cover. fn is passed three functions bound to key:
+// get returns its current value, set stores a value and del deletes it. They can
+// be called any number of times and in any order, and each sees the effect of the
+// ones before it. No other writer can change key between them.
+//
+// get, set and del must only be called from fn, before it returns. fn must not call
+// any method of m: the shard is already write locked, so the call would deadlock
+// on it, as it would once fn touches another key of the same shard. The eviction
+// handler, the hooks and the bounds of WithMaxEntries and WithMaxBytes run for
+// each set and del once fn has returned and the shard has been unlocked.
+func (m *Map[K, V]) Do(key K, fn func(get func() (V, bool), set func(V), del func())) {
+	m.checkWrite()
+	if m.interner != nil {
+		key = m.interner.intern(key)
+	}
+	var ops []doOp[V]
+	var present bool
+	func() {
+		tab, shard := m.lockKey(key)
+		defer tab.mus[shard].Unlock()
+		get := func() (V, bool) {
+			return tab.maps[shard].Get(key)
+		}
+		set := func(value V) {
+			prev, replaced := m.setLocked(tab, shard, key, value)
+			ops = append(ops, doOp[V]{value: value, prev: prev, replaced: replaced})
+		}
+		del := func() {
+			prev, deleted := m.deleteLocked(tab, shard, key)
+			ops = append(ops, doOp[V]{prev: prev, replaced: deleted, del: true})
+		}
+		fn(get, set, del)
+		present = tab.maps[shard].Contains(key)
+	}()
+
+	var inserted bool
+	for _, op := range ops {
+		switch {
+		case !op.del:
+			m.notifySet(key, op.value, op.prev, op.replaced)
+			inserted = inserted || !op.replaced
+		case op.replaced:
+			m.notifyRemove(key, op.prev, EvictDeleted)
+		case m.onDelete != nil:
+			m.onDelete(key, op.prev, false)
+		}
+	}
+	switch {
+	case !present && m.interner != nil:
+		m.interner.release(key)
+	case present && m.overflows(!inserted):
+		m.trim(key)
+	}
+}
+
+// doOp is a set or del made by the fn of Do, kept to call the hooks once the shard
+// is unlocked. For a del, replaced reports whether there was a value to delete.
+type doOp[V any] struct {
+	value, prev V
+	replaced    bool
+	del         bool
+}
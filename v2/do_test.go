@@ -0,0 +1,134 @@
+package shardmap
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestDo(t *testing.T) {
+	var m Map[string, int]
+	// increment if present, store 1 otherwise, and drop the key once it reaches 3
+	incr := func(get func() (int, bool), set func(int), del func()) {
+		v, ok := get()
+		if !ok {
+			set(1)
+			return
+		}
+		set(v + 1)
+		if v, _ := get(); v >= 3 {
+			del()
+		}
+	}
+	for i, want := range []int{1, 2, 0, 1} {
+		m.Do("a", incr)
+		v, ok := m.Get("a")
+		if v != want || ok != (want != 0) {
+			t.Fatalf("call %d: expected %v, got %v/%v", i, want, v, ok)
+		}
+	}
+	if m.Len() != 1 {
+		t.Fatalf("expected %v, got %v", 1, m.Len())
+	}
+
+	// a del and a get of an absent key leave the map unchanged
+	m.Do("b", func(get func() (int, bool), set func(int), del func()) {
+		del()
+		if _, ok := get(); ok {
+			t.Fatal("expected b to be absent")
+		}
+	})
+	if m.Contains("b") || m.Len() != 1 {
+		t.Fatalf("expected b to be absent with Len %v, got Len %v", 1, m.Len())
+	}
+
+	// the whole of fn runs under one lock, so the increments are not lost
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				m.Do("c", func(get func() (int, bool), set func(int), del func()) {
+					v, _ := get()
+					set(v + 1)
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	if v, _ := m.Get("c"); v != 8000 {
+		t.Fatalf("expected %v, got %v", 8000, v)
+	}
+}
+
+func TestDoHooks(t *testing.T) {
+	var mu sync.Mutex
+	var sets, deletes []hookCall
+	var evicted []string
+	m := New[string, int](0,
+		WithOnSet(func(key string, newV, oldV int, replaced bool) {
+			mu.Lock()
+			defer mu.Unlock()
+			sets = append(sets, hookCall{key: key, newV: newV, oldV: oldV, ok: replaced})
+		}),
+		WithOnDelete(func(key string, oldV int, deleted bool) {
+			mu.Lock()
+			defer mu.Unlock()
+			deletes = append(deletes, hookCall{key: key, oldV: oldV, ok: deleted})
+		}),
+		WithMaxEntries[string, int](1),
+		WithShards[string, int](1),
+		WithEvictionHandler(func(key string, value int, reason EvictReason) {
+			if reason == EvictOverflow {
+				mu.Lock()
+				defer mu.Unlock()
+				evicted = append(evicted, key)
+			}
+		}),
+	)
+	m.Do("a", func(get func() (int, bool), set func(int), del func()) {
+		set(1)
+		set(2)
+		del()
+		del()
+		set(3)
+	})
+	wantSets := []hookCall{
+		{key: "a", newV: 1, oldV: 0, ok: false},
+		{key: "a", newV: 2, oldV: 1, ok: true},
+		{key: "a", newV: 3, oldV: 0, ok: false},
+	}
+	wantDeletes := []hookCall{
+		{key: "a", oldV: 2, ok: true},
+		{key: "a", oldV: 0, ok: false},
+	}
+	if !reflect.DeepEqual(sets, wantSets) {
+		t.Fatalf("expected sets %v, got %v", wantSets, sets)
+	}
+	if !reflect.DeepEqual(deletes, wantDeletes) {
+		t.Fatalf("expected deletes %v, got %v", wantDeletes, deletes)
+	}
+
+	// an insert by Do is held to the bound of WithMaxEntries
+	m.Do("b", func(get func() (int, bool), set func(int), del func()) { set(4) })
+	if m.Len() != 1 || !m.Contains("b") || !reflect.DeepEqual(evicted, []string{"a"}) {
+		t.Fatalf("expected a to be evicted for b, got Len %v and evicted %v", m.Len(), evicted)
+	}
+}
+
+func TestDoInterning(t *testing.T) {
+	m := New[string, int](0, WithStringInterning[int]())
+	m.Do("a", func(get func() (int, bool), set func(int), del func()) {})
+	if n := m.interner.(*stringInterner).table.Len(); n != 0 {
+		t.Fatalf("expected a key left absent to be released, got %v interned", n)
+	}
+	m.Do("a", func(get func() (int, bool), set func(int), del func()) { set(1) })
+	if n := m.interner.(*stringInterner).table.Len(); n != 1 {
+		t.Fatalf("expected %v, got %v", 1, n)
+	}
+	m.Do("a", func(get func() (int, bool), set func(int), del func()) { del() })
+	if n := m.interner.(*stringInterner).table.Len(); n != 0 {
+		t.Fatalf("expected %v, got %v", 0, n)
+	}
+}
@@ -0,0 +1,51 @@
+package shardmap
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+)
+
+// MarshalJSON encodes the map as a single JSON object, as encoding/json encodes a
+// map[K]V, so K must be a string, an integer or implement encoding.TextMarshaler.
+// Each shard is copied under its read lock (see Snapshot).
+func (m *Map[K, V]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.Snapshot())
+}
+
+// UnmarshalJSON decodes a JSON object written by MarshalJSON, or any object
+// encoding/json can decode into a map[K]V, and stores its entries in m. Like
+// decoding into a non-empty Go map, existing entries that are not in the object
+// are kept. A zero Map is initialized first, so it can be decoded into directly.
+func (m *Map[K, V]) UnmarshalJSON(data []byte) error {
+	var entries map[K]V
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+	m.SetMany(entries)
+	return nil
+}
+
+// GobEncode encodes the entries of the map with encoding/gob, as a map[K]V, so
+// they can be persisted or sent over RPC. Each shard is copied under its read lock
+// (see Snapshot). Only the entries are encoded, not the shard layout.
+func (m *Map[K, V]) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(m.Snapshot()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode decodes entries written by GobEncode and stores them in m, keeping
+// existing entries that were not encoded. Keys are placed with m's own shard count
+// and hash, so data encoded on a machine with a different number of CPUs, or by a
+// map with different options, decodes correctly.
+func (m *Map[K, V]) GobDecode(data []byte) error {
+	var entries map[K]V
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&entries); err != nil {
+		return err
+	}
+	m.SetMany(entries)
+	return nil
+}
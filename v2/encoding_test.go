@@ -0,0 +1,78 @@
+package shardmap
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"testing"
+)
+
+func TestJSON(t *testing.T) {
+	var m Map[string, int]
+	for i := 0; i < 1000; i++ {
+		m.Set(k(i), i)
+	}
+	data, err := json.Marshal(&m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Map[string, int]
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Len() != 1000 {
+		t.Fatalf("expected %v, got %v", 1000, got.Len())
+	}
+	for i := 0; i < 1000; i++ {
+		if v, ok := got.Get(k(i)); !ok || v != i {
+			t.Fatalf("key %v: expected %v, got %v", k(i), i, v)
+		}
+	}
+
+	// integer keys
+	var n Map[int, string]
+	n.Set(1, "a")
+	data, err = json.Marshal(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"1":"a"}` {
+		t.Fatalf("expected %s, got %s", `{"1":"a"}`, data)
+	}
+	var empty Map[int, string]
+	if data, err := json.Marshal(&empty); err != nil || string(data) != "{}" {
+		t.Fatalf("expected {}, got %s, %v", data, err)
+	}
+
+	if err := json.Unmarshal([]byte(`[1]`), &got); err == nil {
+		t.Fatal("expected an error for a non object")
+	}
+}
+
+func TestGob(t *testing.T) {
+	m := New[string, []string](0, WithShards[string, []string](64))
+	for i := 0; i < 1000; i++ {
+		m.Set(k(i), []string{k(i), "x"})
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(m); err != nil {
+		t.Fatal(err)
+	}
+	// a map with another shard count places the keys again
+	got := New[string, []string](0, WithShards[string, []string](4))
+	if err := gob.NewDecoder(&buf).Decode(got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Len() != 1000 || len(got.ShardSizes()) != 4 {
+		t.Fatalf("expected %v entries in %v shards, got %v in %v", 1000, 4, got.Len(), len(got.ShardSizes()))
+	}
+	for i := 0; i < 1000; i++ {
+		if v, ok := got.Get(k(i)); !ok || len(v) != 2 || v[0] != k(i) {
+			t.Fatalf("key %v: expected %v, got %v", k(i), []string{k(i), "x"}, v)
+		}
+	}
+
+	if err := got.GobDecode([]byte("bad")); err == nil {
+		t.Fatal("expected an error for bad data")
+	}
+}
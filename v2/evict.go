@@ -0,0 +1,55 @@
+package shardmap
+
+// EvictReason describes why an entry was removed from a Map.
+type EvictReason uint8
+
+const (
+	// EvictExpired is an entry that outlived its time to live.
+	EvictExpired EvictReason = iota + 1
+	// EvictOverflow is an entry removed to keep the map within a size bound.
+	EvictOverflow
+	// EvictDeleted is an entry removed by a Delete call.
+	EvictDeleted
+	// EvictReplaced is a value that was overwritten by a Set of the same key.
+	EvictReplaced
+	// EvictCleared is an entry discarded by Clear.
+	EvictCleared
+)
+
+// String implements fmt.Stringer.
+func (r EvictReason) String() string {
+	switch r {
+	case EvictExpired:
+		return "Expired"
+	case EvictOverflow:
+		return "Overflow"
+	case EvictDeleted:
+		return "Deleted"
+	case EvictReplaced:
+		return "Replaced"
+	case EvictCleared:
+		return "Cleared"
+	}
+	return "Unknown"
+}
+
+// WithEvictionHandler registers fn to be called every time an entry leaves the map,
+// with the key, the value that was removed and the reason. For EvictReplaced the
+// value is the old value that was overwritten.
+//
+// fn is called after the shard lock has been released, so it may call back into
+// the map. Because of that, by the time fn runs the key may already have been set
+// again by another goroutine. Changes that are rejected by SetAccept or
+// DeleteAccept do not call fn.
+func WithEvictionHandler[K comparable, V any](fn func(key K, value V, reason EvictReason)) Option[K, V] {
+	return func(m *Map[K, V]) {
+		m.onEvict = fn
+	}
+}
+
+// evicted calls the eviction handler, if one is registered.
+func (m *Map[K, V]) evicted(key K, value V, reason EvictReason) {
+	if m.onEvict != nil {
+		m.onEvict(key, value, reason)
+	}
+}
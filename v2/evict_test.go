@@ -0,0 +1,105 @@
+package shardmap
+
+import (
+	"sync"
+	"testing"
+)
+
+type eviction struct {
+	key    string
+	value  int
+	reason EvictReason
+}
+
+func TestEvictionHandler(t *testing.T) {
+	var mu sync.Mutex
+	var got []eviction
+	m := New[string, int](0, WithEvictionHandler(func(key string, value int, reason EvictReason) {
+		mu.Lock()
+		got = append(got, eviction{key, value, reason})
+		mu.Unlock()
+	}))
+	expect := func(want ...eviction) {
+		t.Helper()
+		if len(got) != len(want) {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("expected %v, got %v", want[i], got[i])
+			}
+		}
+		got = nil
+	}
+
+	m.Set("a", 1)
+	expect()
+	m.Set("a", 2)
+	expect(eviction{"a", 1, EvictReplaced})
+	m.SetAccept("a", 3, func(int, bool) bool { return false })
+	expect()
+	m.SetAccept("a", 3, nil)
+	expect(eviction{"a", 2, EvictReplaced})
+	m.Delete("a")
+	expect(eviction{"a", 3, EvictDeleted})
+	m.Delete("a")
+	expect()
+
+	m.Set("b", 1)
+	m.DeleteAccept("b", func(int, bool) bool { return false })
+	expect()
+	m.DeleteAccept("b", nil)
+	expect(eviction{"b", 1, EvictDeleted})
+
+	m.Set("c", 1)
+	m.Clear()
+	expect(eviction{"c", 1, EvictCleared})
+
+	src := m.NewLike()
+	src.Set("d", 2)
+	m.Set("d", 1)
+	m.LoadParallel(src, 1)
+	expect(eviction{"d", 1, EvictReplaced})
+}
+
+func TestEvictReasonString(t *testing.T) {
+	for r, want := range map[EvictReason]string{
+		EvictExpired:  "Expired",
+		EvictOverflow: "Overflow",
+		EvictDeleted:  "Deleted",
+		EvictReplaced: "Replaced",
+		EvictCleared:  "Cleared",
+		0:             "Unknown",
+	} {
+		if r.String() != want {
+			t.Fatalf("expected %v, got %v", want, r.String())
+		}
+	}
+}
+
+func TestEvictionHandlerClear(t *testing.T) {
+	var m *Map[int, int]
+	counts := map[EvictReason]int{}
+	m = New[int, int](0, WithEvictionHandler(func(key, value int, reason EvictReason) {
+		counts[reason]++
+		// the handler runs outside the shard lock, so it may use the map
+		m.Get(key)
+	}))
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	m.Clear()
+	if counts[EvictCleared] != 1000 {
+		t.Fatalf("expected %v, got %v", 1000, counts[EvictCleared])
+	}
+	for i := 0; i < 500; i++ {
+		m.Set(i, i)
+	}
+	m.ResetKeep()
+	if counts[EvictCleared] != 1500 {
+		t.Fatalf("expected %v, got %v", 1500, counts[EvictCleared])
+	}
+	if len(counts) != 1 {
+		t.Fatalf("expected only %v evictions, got %v", EvictCleared, counts)
+	}
+}
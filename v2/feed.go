@@ -0,0 +1,114 @@
+package shardmap
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// feedBuffer is the number of changes a subscriber's channel can hold before
+// further changes are dropped for that subscriber.
+const feedBuffer = 1024
+
+// Change describes a mutation of a Map delivered by Subscribe.
+type Change[K comparable, V any] struct {
+	// Key is the key that changed.
+	Key K
+	// Value is the value stored for Key. It is the zero value for a deletion.
+	Value V
+	// Deleted is true when Key was removed from the map.
+	Deleted bool
+}
+
+// feed holds the subscribers of a Map. The subscriber list is copied on change so
+// that writers only pay an atomic load when nobody is subscribed.
+type feed[K comparable, V any] struct {
+	mu   sync.Mutex
+	subs atomic.Pointer[[]chan Change[K, V]]
+}
+
+// Subscribe returns a channel that receives a Change for every key that is set or
+// deleted from now on, and a function that ends the subscription and closes the
+// channel. The cancel function may be called more than once.
+//
+// Changes are sent while the key's shard is write locked, so changes to keys in the
+// same shard, and therefore all changes to one key, arrive in the order they were
+// applied. A Clear or ResetKeep is delivered as a deletion of every entry.
+//
+// Delivery is at most once: the channel buffers up to 1024 changes and a change
+// that does not fit because the subscriber is falling behind is dropped for that
+// subscriber, rather than blocking writers. A consumer that must not miss changes
+// has to read promptly, or resynchronize from the map when it may have fallen
+// behind (len(ch) == cap(ch) is a sign of that).
+func (m *Map[K, V]) Subscribe() (<-chan Change[K, V], func()) {
+	m.initDo()
+	ch := make(chan Change[K, V], feedBuffer)
+	m.feed.mu.Lock()
+	var subs []chan Change[K, V]
+	if p := m.feed.subs.Load(); p != nil {
+		subs = slices.Clone(*p)
+	}
+	subs = append(subs, ch)
+	m.feed.subs.Store(&subs)
+	m.feed.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() { m.unsubscribe(ch) })
+	}
+}
+
+// unsubscribe removes ch from the subscribers and closes it.
+func (m *Map[K, V]) unsubscribe(ch chan Change[K, V]) {
+	m.feed.mu.Lock()
+	subs := slices.DeleteFunc(slices.Clone(*m.feed.subs.Load()), func(c chan Change[K, V]) bool {
+		return c == ch
+	})
+	if len(subs) == 0 {
+		m.feed.subs.Store(nil)
+	} else {
+		m.feed.subs.Store(&subs)
+	}
+	m.feed.mu.Unlock()
+	// Writers send under their shard lock. Once every shard has been locked after
+	// the removal no writer can still be sending to ch and it is safe to close.
+	// Holding the table makes sure no writer is still using an older one.
+	tab := m.holdTable()
+	for i := 0; i < tab.shards; i++ {
+		tab.mus[i].Lock()
+		tab.mus[i].Unlock()
+	}
+	m.layout.exit()
+	close(ch)
+}
+
+// subscribed reports whether anyone is subscribed to changes.
+func (m *Map[K, V]) subscribed() bool {
+	return m.feed.subs.Load() != nil
+}
+
+// publish sends c to every subscriber that has room for it. The caller must hold
+// the write lock of the shard c.Key belongs to.
+func (m *Map[K, V]) publish(c Change[K, V]) {
+	p := m.feed.subs.Load()
+	if p == nil {
+		return
+	}
+	for _, ch := range *p {
+		select {
+		case ch <- c:
+		default:
+		}
+	}
+}
+
+// publishCleared publishes the deletion of every entry in the shard. The caller
+// must hold the shard's write lock.
+func (m *Map[K, V]) publishCleared(tab *table[K, V], shard int) {
+	if !m.subscribed() {
+		return
+	}
+	for k := range tab.maps[shard].All() {
+		m.publish(Change[K, V]{Key: k, Deleted: true})
+	}
+}
@@ -0,0 +1,69 @@
+package shardmap
+
+import "testing"
+
+func TestSubscribe(t *testing.T) {
+	var m Map[string, int]
+	m.Set("before", 1)
+	ch, cancel := m.Subscribe()
+
+	m.Set("a", 1)
+	m.Set("a", 2)
+	m.Delete("a")
+	m.Delete("missing")
+	m.Set("b", 3)
+	m.Clear()
+
+	want := []Change[string, int]{
+		{Key: "a", Value: 1},
+		{Key: "a", Value: 2},
+		{Key: "a", Deleted: true},
+		{Key: "b", Value: 3},
+	}
+	for _, w := range want {
+		if got := <-ch; got != w {
+			t.Fatalf("expected %+v, got %+v", w, got)
+		}
+	}
+	cleared := map[string]bool{}
+	for len(ch) > 0 {
+		c := <-ch
+		if !c.Deleted {
+			t.Fatalf("expected a deletion, got %+v", c)
+		}
+		cleared[c.Key] = true
+	}
+	if len(cleared) != 2 || !cleared["before"] || !cleared["b"] {
+		t.Fatalf("expected deletions of before and b, got %v", cleared)
+	}
+
+	cancel()
+	cancel()
+	m.Set("after", 1)
+	if _, ok := <-ch; ok {
+		t.Fatal("expected the channel to be closed")
+	}
+}
+
+func TestSubscribeDropsOnOverflow(t *testing.T) {
+	var m Map[int, int]
+	ch, cancel := m.Subscribe()
+	defer cancel()
+	other, cancelOther := m.Subscribe()
+	cancelOther()
+
+	for i := 0; i < feedBuffer*2; i++ {
+		m.Set(i, i)
+	}
+	if len(ch) != feedBuffer {
+		t.Fatalf("expected %v, got %v", feedBuffer, len(ch))
+	}
+	for i := 0; i < feedBuffer; i++ {
+		if c := <-ch; c.Key != i {
+			t.Fatalf("expected %v, got %v", i, c.Key)
+		}
+	}
+	if _, ok := <-other; ok {
+		t.Fatal("expected the canceled channel to be closed and empty")
+	}
+}
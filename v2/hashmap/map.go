@@ -142,6 +142,24 @@ func (m *Map[K, V]) Get(key K) (value V, ok bool) {
 	}
 }
 
+// Contains reports whether key has a value, without copying the value.
+func (m *Map[K, V]) Contains(key K) bool {
+	if len(m.buckets) == 0 {
+		return false
+	}
+	hash := m.hash(key)
+	i := hash & m.mask
+	for {
+		if m.buckets[i].dib() == 0 {
+			return false
+		}
+		if m.buckets[i].hash() == hash && m.buckets[i].key == key {
+			return true
+		}
+		i = (i + 1) & m.mask
+	}
+}
+
 // Len returns the number of values in map.
 func (m *Map[K, V]) Len() int {
 	return m.length
@@ -200,6 +218,21 @@ func (m *Map[K, V]) All() iter.Seq2[K, V] {
 	}
 }
 
+// AllKeys returns an iterator over all keys. Unlike All it does not copy the
+// values, which matters when they are large. It's not safe to call Set or Delete
+// while scanning.
+func (m *Map[K, V]) AllKeys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		for i := 0; i < len(m.buckets); i++ {
+			if m.buckets[i].dib() > 0 {
+				if !yield(m.buckets[i].key) {
+					return
+				}
+			}
+		}
+	}
+}
+
 // Scan iterates over all key/values.
 // It's not safe to call or Set or Delete while scanning.
 func (m *Map[K, V]) Scan(iter func(key K, value V) bool) {
@@ -212,6 +245,32 @@ func (m *Map[K, V]) Scan(iter func(key K, value V) bool) {
 	}
 }
 
+// ScanFrom iterates over key/values starting at bucket position pos, which is 0 for
+// the first call. It stops after iter returns false and returns the position to
+// resume from, or -1 once the end of the map was reached. Positions are only
+// stable while the map is not changed: an entry may be missed or visited twice if
+// the map is modified between calls.
+func (m *Map[K, V]) ScanFrom(pos int, iter func(key K, value V) bool) int {
+	for i := max(pos, 0); i < len(m.buckets); i++ {
+		if m.buckets[i].dib() > 0 {
+			if !iter(m.buckets[i].key, m.buckets[i].value) {
+				return i + 1
+			}
+		}
+	}
+	return -1
+}
+
+// Update replaces every value with the result of fn(key, value), in place. The
+// buckets are not moved, so fn must not call Set or Delete on the map.
+func (m *Map[K, V]) Update(fn func(key K, value V) V) {
+	for i := 0; i < len(m.buckets); i++ {
+		if m.buckets[i].dib() > 0 {
+			m.buckets[i].value = fn(m.buckets[i].key, m.buckets[i].value)
+		}
+	}
+}
+
 // Keys returns all keys as a slice
 func (m *Map[K, V]) Keys() []K {
 	keys := make([]K, 0, m.length)
@@ -234,6 +293,63 @@ func (m *Map[K, V]) Values() []V {
 	return values
 }
 
+// Clear removes all values but keeps the allocated buckets, so the map can be
+// refilled to its previous size without growing.
+func (m *Map[K, V]) Clear() {
+	clear(m.buckets)
+	m.length = 0
+}
+
+// MaxProbeLength returns the largest number of buckets a lookup has to examine to
+// find a key that is in the map, which is 1 when every key sits in its home bucket.
+// It returns 0 for an empty map. Rising values indicate poor hashing or a high
+// load. It scans every bucket.
+func (m *Map[K, V]) MaxProbeLength() int {
+	var n int
+	for i := 0; i < len(m.buckets); i++ {
+		n = max(n, m.buckets[i].dib())
+	}
+	return n
+}
+
+// Cap returns the number of buckets of the map, which it can hold a little less
+// than before it grows.
+func (m *Map[K, V]) Cap() int {
+	return len(m.buckets)
+}
+
+// Shrink reallocates the buckets to the smallest size that holds the current
+// values without growing on the next Set. Deletes only shrink the map once it is
+// mostly empty, and never below the capacity it was created with; Shrink does
+// both, and the smaller size becomes the map's capacity.
+func (m *Map[K, V]) Shrink() {
+	sz := 8
+	for int(float64(sz)*loadFactor) <= m.length {
+		sz *= 2
+	}
+	if sz < len(m.buckets) {
+		m.resize(sz)
+		m.cap = sz
+	}
+}
+
+// Grow makes room for n more values, reallocating the buckets at once if needed,
+// so the next n Sets of new keys do not grow the map. It does nothing when there is
+// already room or n <= 0. Like the growth done by Set, it does not change the
+// capacity below which deletes never shrink the map.
+func (m *Map[K, V]) Grow(n int) {
+	if n <= 0 {
+		return
+	}
+	sz := max(len(m.buckets), 8)
+	for int(float64(sz)*loadFactor) < m.length+n {
+		sz *= 2
+	}
+	if sz > len(m.buckets) {
+		m.resize(sz)
+	}
+}
+
 // Copy the hashmap.
 func (m *Map[K, V]) Copy() *Map[K, V] {
 	m2 := new(Map[K, V])
@@ -530,6 +530,86 @@ func TestEmpty(t *testing.T) {
 	}
 }
 
+func TestClear(t *testing.T) {
+	var m Map[int, int]
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	buckets := len(m.buckets)
+	m.Clear()
+	if m.Len() != 0 {
+		t.Fatalf("expected %d got %d", 0, m.Len())
+	}
+	if len(m.buckets) != buckets {
+		t.Fatalf("expected %d got %d", buckets, len(m.buckets))
+	}
+	if _, ok := m.Get(1); ok {
+		t.Fatal()
+	}
+	for range m.All() {
+		t.Fatal()
+	}
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	if len(m.buckets) != buckets {
+		t.Fatalf("expected %d got %d", buckets, len(m.buckets))
+	}
+}
+
+func TestMaxProbeLength(t *testing.T) {
+	var m Map[int, int]
+	if m.MaxProbeLength() != 0 {
+		t.Fatalf("expected %d got %d", 0, m.MaxProbeLength())
+	}
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	var want int
+	for i := 0; i < len(m.buckets); i++ {
+		if dib := m.buckets[i].dib(); dib > 0 {
+			// walk the probe sequence the same way Get does
+			probes := 1
+			for j := m.buckets[i].hash() & m.mask; j != i; j = (j + 1) & m.mask {
+				probes++
+			}
+			want = max(want, probes)
+		}
+	}
+	if got := m.MaxProbeLength(); got != want || got < 1 {
+		t.Fatalf("expected %d got %d", want, got)
+	}
+}
+
+func TestScanFrom(t *testing.T) {
+	var m Map[int, int]
+	if pos := m.ScanFrom(0, func(int, int) bool { return true }); pos != -1 {
+		t.Fatalf("expected %d got %d", -1, pos)
+	}
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	seen := make(map[int]bool)
+	var calls int
+	for pos := 0; pos >= 0; calls++ {
+		var n int
+		pos = m.ScanFrom(pos, func(key, value int) bool {
+			if seen[key] {
+				t.Fatalf("key %d visited twice", key)
+			}
+			seen[key] = true
+			n++
+			return n < 10
+		})
+	}
+	if len(seen) != 1000 {
+		t.Fatalf("expected %d got %d", 1000, len(seen))
+	}
+	if calls < 100 {
+		t.Fatalf("expected at least %d calls got %d", 100, calls)
+	}
+}
+
 func TestGetPos(t *testing.T) {
 	var m Map[int, int]
 	if _, _, ok := m.GetPos(100); ok {
@@ -589,3 +669,146 @@ func TestIssue3(t *testing.T) {
 		}
 	}
 }
+
+func TestUpdate(t *testing.T) {
+	var m Map[int, int]
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	buckets := len(m.buckets)
+	m.Update(func(key, value int) int { return key + value })
+	if m.Len() != 1000 {
+		t.Fatalf("expected %d got %d", 1000, m.Len())
+	}
+	if len(m.buckets) != buckets {
+		t.Fatalf("expected %d got %d", buckets, len(m.buckets))
+	}
+	for i := 0; i < 1000; i++ {
+		if v, _ := m.Get(i); v != i*2 {
+			t.Fatalf("expected %d got %d", i*2, v)
+		}
+	}
+}
+
+func TestContains(t *testing.T) {
+	var m Map[int, int]
+	if m.Contains(1) {
+		t.Fatal("expected false")
+	}
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	for i := 0; i < 2000; i++ {
+		if m.Contains(i) != (i < 1000) {
+			t.Fatalf("key %d: expected %v", i, i < 1000)
+		}
+	}
+	m.Delete(1)
+	if m.Contains(1) {
+		t.Fatal("expected false after delete")
+	}
+}
+
+func TestAllKeys(t *testing.T) {
+	var m Map[int, int]
+	for range m.AllKeys() {
+		t.Fatal("expected no keys")
+	}
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	seen := make(map[int]bool)
+	for key := range m.AllKeys() {
+		if seen[key] {
+			t.Fatalf("key %d: returned twice", key)
+		}
+		seen[key] = true
+	}
+	if len(seen) != 1000 {
+		t.Fatalf("expected %d, got %d", 1000, len(seen))
+	}
+	var n int
+	for range m.AllKeys() {
+		n++
+		break
+	}
+	if n != 1 {
+		t.Fatalf("expected %d, got %d", 1, n)
+	}
+}
+
+func TestShrink(t *testing.T) {
+	var m Map[int, int]
+	for i := 0; i < 10000; i++ {
+		m.Set(i, i)
+	}
+	grown := m.Cap()
+	// deleting down to 30% full does not shrink on its own
+	for i := 3000; i < 10000; i++ {
+		m.Delete(i)
+	}
+	if m.Cap() != grown {
+		t.Fatalf("expected %d got %d", grown, m.Cap())
+	}
+	m.Shrink()
+	if m.Cap() != 4096 {
+		t.Fatalf("expected %d got %d", 4096, m.Cap())
+	}
+	for i := 0; i < 3000; i++ {
+		if v, ok := m.Get(i); !ok || v != i {
+			t.Fatalf("expected %d got %d", i, v)
+		}
+	}
+	m.Shrink()
+	if m.Cap() != 4096 {
+		t.Fatalf("expected %d got %d", 4096, m.Cap())
+	}
+
+	// the capacity the map was created with is released too
+	n := New[int, int](1000)
+	n.Set(1, 1)
+	n.Shrink()
+	if n.Cap() != 8 {
+		t.Fatalf("expected %d got %d", 8, n.Cap())
+	}
+	for i := 0; i < 100; i++ {
+		n.Set(i, i)
+	}
+	if n.Len() != 100 {
+		t.Fatalf("expected %d got %d", 100, n.Len())
+	}
+}
+
+func TestGrow(t *testing.T) {
+	var m Map[int, int]
+	m.Grow(1000)
+	grown := m.Cap()
+	if grown < 1000 {
+		t.Fatalf("expected at least %d got %d", 1000, grown)
+	}
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	if m.Cap() != grown {
+		t.Fatalf("expected %d got %d", grown, m.Cap())
+	}
+	// there is room for 1000 values, but not 1000 more
+	m.Grow(1)
+	if m.Cap() != grown {
+		t.Fatalf("expected %d got %d", grown, m.Cap())
+	}
+	m.Grow(1000)
+	if m.Cap() <= grown {
+		t.Fatalf("expected more than %d got %d", grown, m.Cap())
+	}
+	for i := 0; i < 1000; i++ {
+		if v, ok := m.Get(i); !ok || v != i {
+			t.Fatalf("expected %d got %d", i, v)
+		}
+	}
+	m.Grow(0)
+	m.Grow(-1)
+	if m.Len() != 1000 {
+		t.Fatalf("expected %d got %d", 1000, m.Len())
+	}
+}
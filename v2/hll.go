@@ -0,0 +1,98 @@
+package shardmap
+
+import (
+	"hash/maphash"
+	"math"
+	"math/bits"
+	"sync/atomic"
+)
+
+const (
+	// hllPrecision is the number of hash bits that select a register.
+	hllPrecision = 14
+	hllRegisters = 1 << hllPrecision
+)
+
+// WithCardinalityEstimator maintains a HyperLogLog sketch of the keys stored in the
+// map, queried with EstimatedLen. Every insert of a new key costs an extra hash and
+// an atomic update of a 16KiB register array; reading the estimate takes no locks.
+func WithCardinalityEstimator[K comparable, V any]() Option[K, V] {
+	return func(m *Map[K, V]) {
+		m.card = newHLL()
+	}
+}
+
+// EstimatedLen returns the approximate number of distinct keys stored in the map
+// since it was created or last cleared, without taking any locks. It returns -1 if
+// the map was not created with WithCardinalityEstimator.
+//
+// The sketch uses 2^14 registers, for a standard error of about 0.81%: the estimate
+// is within 1.6% of the true count about 95% of the time. Deletes are not
+// reflected, as a HyperLogLog sketch can only grow; use Len for the current size.
+func (m *Map[K, V]) EstimatedLen() int {
+	if m.card == nil {
+		return -1
+	}
+	return int(m.card.estimate())
+}
+
+// hll is a HyperLogLog sketch with 8 bit registers packed four to a word, so that
+// registers can be raised with a compare and swap.
+type hll struct {
+	seed  maphash.Seed
+	words [hllRegisters / 4]atomic.Uint32
+}
+
+func newHLL() *hll {
+	return &hll{seed: maphash.MakeSeed()}
+}
+
+// add records a hash of a key.
+func (h *hll) add(hash uint64) {
+	idx := hash >> (64 - hllPrecision)
+	// The rank is the position of the first set bit in the remaining bits. The
+	// sentinel bit bounds it should they all be zero.
+	rank := uint32(bits.LeadingZeros64(hash<<hllPrecision|1<<(hllPrecision-1))) + 1
+	word := &h.words[idx/4]
+	shift := (idx % 4) * 8
+	for {
+		old := word.Load()
+		if (old>>shift)&0xff >= rank {
+			return
+		}
+		if word.CompareAndSwap(old, old&^(0xff<<shift)|rank<<shift) {
+			return
+		}
+	}
+}
+
+// estimate returns the estimated number of distinct hashes added.
+func (h *hll) estimate() float64 {
+	var sum float64
+	var zeros int
+	for i := range h.words {
+		w := h.words[i].Load()
+		for j := 0; j < 4; j++ {
+			r := (w >> (j * 8)) & 0xff
+			if r == 0 {
+				zeros++
+			}
+			sum += 1 / float64(uint64(1)<<r)
+		}
+	}
+	const m = float64(hllRegisters)
+	alpha := 0.7213 / (1 + 1.079/m)
+	e := alpha * m * m / sum
+	if e <= 2.5*m && zeros > 0 {
+		// linear counting is more accurate for small cardinalities
+		e = m * math.Log(m/float64(zeros))
+	}
+	return math.Round(e)
+}
+
+// reset clears the sketch.
+func (h *hll) reset() {
+	for i := range h.words {
+		h.words[i].Store(0)
+	}
+}
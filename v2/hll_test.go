@@ -0,0 +1,39 @@
+package shardmap
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEstimatedLen(t *testing.T) {
+	var plain Map[int, int]
+	if plain.EstimatedLen() != -1 {
+		t.Fatalf("expected %v, got %v", -1, plain.EstimatedLen())
+	}
+
+	m := New[int, int](0, WithCardinalityEstimator[int, int]())
+	if m.EstimatedLen() != 0 {
+		t.Fatalf("expected %v, got %v", 0, m.EstimatedLen())
+	}
+	for i := 0; i < 100; i++ {
+		m.Set(i, i)
+		m.Set(i, i+1) // replacing must not count twice
+	}
+	if est := m.EstimatedLen(); est < 98 || est > 102 {
+		t.Fatalf("expected about %v, got %v", 100, est)
+	}
+
+	const n = 200000
+	for i := 0; i < n; i++ {
+		m.Set(i, i)
+	}
+	est := m.EstimatedLen()
+	if diff := math.Abs(float64(est-n)) / n; diff > 0.03 {
+		t.Fatalf("expected about %v, got %v (%.2f%% off)", n, est, diff*100)
+	}
+
+	m.Clear()
+	if m.EstimatedLen() != 0 {
+		t.Fatalf("expected %v, got %v", 0, m.EstimatedLen())
+	}
+}
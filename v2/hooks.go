@@ -0,0 +1,57 @@
+package shardmap
+
+// WithOnSet registers fn to be called for every value stored in the map, with the
+// key, the new value, the value it replaced and whether there was one. It sees
+// every kind of store: Set and its variants, batch loads, transactions and
+// rewrites by TransformValues.
+//
+// Like the eviction handler, fn is called after the mutation is complete and the
+// shard lock has been released, so it may call back into the map without
+// deadlocking. The price is that calls for the same key can be delivered out of
+// order when it is written concurrently, and the key may have changed again by the
+// time fn runs; use SetNotify or Subscribe when the order matters. Calls may run
+// concurrently. Stores rejected by a condition (SetAccept, SetIf and the like) do
+// not call fn.
+func WithOnSet[K comparable, V any](fn func(key K, newV V, oldV V, replaced bool)) Option[K, V] {
+	return func(m *Map[K, V]) {
+		m.onSet = fn
+	}
+}
+
+// WithOnDelete registers fn to be called for every entry that leaves the map other
+// than by being overwritten, with the key, the removed value and true. That covers
+// deletes, expired and evicted entries and entries discarded by Clear. A Delete of
+// a key that has no value calls fn with the zero value and false.
+//
+// fn is called outside the shard lock like the function of WithOnSet, with the
+// same caveats.
+func WithOnDelete[K comparable, V any](fn func(key K, oldV V, deleted bool)) Option[K, V] {
+	return func(m *Map[K, V]) {
+		m.onDelete = fn
+	}
+}
+
+// stored is a completed store, kept to call the hooks once the shard is unlocked.
+type stored[K comparable, V any] struct {
+	key         K
+	value, prev V
+	replaced    bool
+}
+
+// notifySet calls the OnSet hook and the eviction handler for a stored key.
+func (m *Map[K, V]) notifySet(key K, value, prev V, replaced bool) {
+	if m.onSet != nil {
+		m.onSet(key, value, prev, replaced)
+	}
+	if replaced {
+		m.evicted(key, prev, EvictReplaced)
+	}
+}
+
+// notifyRemove calls the OnDelete hook and the eviction handler for a removed key.
+func (m *Map[K, V]) notifyRemove(key K, prev V, reason EvictReason) {
+	if m.onDelete != nil {
+		m.onDelete(key, prev, true)
+	}
+	m.evicted(key, prev, reason)
+}
@@ -0,0 +1,94 @@
+package shardmap
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// hookCall is a call of a WithOnSet or WithOnDelete hook; ok is replaced or
+// deleted.
+type hookCall struct {
+	key        string
+	newV, oldV int
+	ok         bool
+}
+
+func TestHooks(t *testing.T) {
+	var mu sync.Mutex
+	var sets []hookCall
+	var deletes []hookCall
+	m := New[string, int](0,
+		WithOnSet(func(key string, newV, oldV int, replaced bool) {
+			mu.Lock()
+			defer mu.Unlock()
+			sets = append(sets, hookCall{key: key, newV: newV, oldV: oldV, ok: replaced})
+		}),
+		WithOnDelete(func(key string, oldV int, deleted bool) {
+			mu.Lock()
+			defer mu.Unlock()
+			deletes = append(deletes, hookCall{key: key, oldV: oldV, ok: deleted})
+		}),
+	)
+
+	m.Set("a", 1)
+	m.Set("a", 2)
+	m.GetOrSet("b", 3)
+	m.GetOrSet("b", 4) // loaded, no store
+	m.SetIf("b", 5, func(old int, exists bool) bool { return !exists })
+	m.SetMany(map[string]int{"c": 6})
+	want := []hookCall{
+		{key: "a", newV: 1},
+		{key: "a", newV: 2, oldV: 1, ok: true},
+		{key: "b", newV: 3},
+		{key: "c", newV: 6},
+	}
+	if !reflect.DeepEqual(sets, want) {
+		t.Fatalf("expected %v, got %v", want, sets)
+	}
+
+	m.Delete("a")
+	m.Delete("a")
+	m.Clear()
+	want = []hookCall{
+		{key: "a", oldV: 2, ok: true},
+		{key: "a"},
+	}
+	if !reflect.DeepEqual(deletes[:2], want) {
+		t.Fatalf("expected %v, got %v", want, deletes[:2])
+	}
+	cleared := map[string]int{}
+	for _, c := range deletes[2:] {
+		if !c.ok {
+			t.Fatalf("key %v: expected deleted to be true", c.key)
+		}
+		cleared[c.key] = c.oldV
+	}
+	if !reflect.DeepEqual(cleared, map[string]int{"b": 3, "c": 6}) {
+		t.Fatalf("expected %v, got %v", map[string]int{"b": 3, "c": 6}, cleared)
+	}
+}
+
+func TestHooksReentrant(t *testing.T) {
+	var m *Map[string, int]
+	m = New[string, int](0, WithOnSet(func(key string, newV, oldV int, replaced bool) {
+		// the shard is unlocked, so the hook can use the map
+		if v, ok := m.Get(key); !ok || v != newV {
+			t.Errorf("key %v: expected %v, got %v", key, newV, v)
+		}
+	}))
+	m.Set("a", 1)
+}
+
+func TestHooksNil(t *testing.T) {
+	m := New[string, int](0, WithOnSet[string, int](nil), WithOnDelete[string, int](nil))
+	m.Set("a", 1)
+	m.Set("a", 2)
+	m.Delete("a")
+	m.Delete("a")
+	m.Set("b", 1)
+	m.Clear()
+	if m.Len() != 0 {
+		t.Fatalf("expected %v, got %v", 0, m.Len())
+	}
+}
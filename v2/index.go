@@ -0,0 +1,234 @@
+package shardmap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strings"
+)
+
+// The index format is:
+//
+//	header:  magic [4]byte | version uint32 | count uint64 | table offset uint64
+//	records: count x (key length uint32 | value length uint32 | key | value)
+//	table:   count x record offset uint64
+//
+// Records are sorted by key and all integers are little endian. The offset table
+// allows a key to be found with a binary search without reading the records.
+const (
+	indexMagic      = "SMIX"
+	indexVersion    = 1
+	indexHeaderSize = 24
+	recordHeadSize  = 8
+)
+
+// ErrBadIndex is returned by OpenIndex when the data is not a valid index, for
+// example because it was truncated.
+var ErrBadIndex = errors.New("shardmap: not a valid index")
+
+// BuildIndex writes the entries of m to w in a read-only, sorted format that can be
+// queried with OpenIndex without loading it into memory. Each shard is copied under
+// its read lock, so writes made concurrently with BuildIndex may or may not be
+// included. Offsets inside the index are relative to the position of w when
+// BuildIndex is called, which is also where the header is rewritten once the
+// records are done. To open an index that does not start at offset 0, wrap the
+// reader with io.NewSectionReader. Keys and values are limited to 4 GiB each; an
+// entry over the limit is reported as an error before anything is written.
+func BuildIndex(m *Map[string, []byte], w io.WriteSeeker) error {
+	tab := m.table()
+	var entries []kv[string, []byte]
+	for i := 0; i < tab.shards; i++ {
+		entries = tab.appendShard(entries, i)
+	}
+	for _, e := range entries {
+		if uint64(len(e.key)) > math.MaxUint32 || uint64(len(e.value)) > math.MaxUint32 {
+			return fmt.Errorf("shardmap: index entry too large: key of %d bytes, value of %d bytes",
+				len(e.key), len(e.value))
+		}
+	}
+	slices.SortFunc(entries, func(a, b kv[string, []byte]) int {
+		return strings.Compare(a.key, b.key)
+	})
+
+	start, err := w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	header := make([]byte, indexHeaderSize)
+	if _, err := bw.Write(header); err != nil {
+		return err
+	}
+
+	offsets := make([]uint64, len(entries))
+	off := uint64(indexHeaderSize)
+	var head [recordHeadSize]byte
+	for i, e := range entries {
+		offsets[i] = off
+		binary.LittleEndian.PutUint32(head[0:], uint32(len(e.key)))
+		binary.LittleEndian.PutUint32(head[4:], uint32(len(e.value)))
+		if _, err := bw.Write(head[:]); err != nil {
+			return err
+		}
+		if _, err := bw.WriteString(e.key); err != nil {
+			return err
+		}
+		if _, err := bw.Write(e.value); err != nil {
+			return err
+		}
+		off += recordHeadSize + uint64(len(e.key)) + uint64(len(e.value))
+	}
+	tableOff := off
+	var b [8]byte
+	for _, o := range offsets {
+		binary.LittleEndian.PutUint64(b[:], o)
+		if _, err := bw.Write(b[:]); err != nil {
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	end, err := w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	copy(header, indexMagic)
+	binary.LittleEndian.PutUint32(header[4:], indexVersion)
+	binary.LittleEndian.PutUint64(header[8:], uint64(len(entries)))
+	binary.LittleEndian.PutUint64(header[16:], tableOff)
+	if _, err := w.Seek(start, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err = w.Seek(end, io.SeekStart)
+	return err
+}
+
+// Index is a read-only view of an index written by BuildIndex. Lookups read only
+// the parts of the underlying data they need, so the data can be far larger than
+// memory (for example a memory mapped file). An Index is safe for concurrent use
+// if the underlying io.ReaderAt is.
+type Index struct {
+	r        io.ReaderAt
+	count    int
+	tableOff int64
+}
+
+// OpenIndex opens an index written by BuildIndex. Only the header and the last
+// record offset are read, the latter to check that the index is complete.
+func OpenIndex(r io.ReaderAt) (*Index, error) {
+	header := make([]byte, indexHeaderSize)
+	if err := readFull(r, header, 0); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrBadIndex
+		}
+		return nil, err
+	}
+	if string(header[:4]) != indexMagic {
+		return nil, ErrBadIndex
+	}
+	if v := binary.LittleEndian.Uint32(header[4:]); v != indexVersion {
+		return nil, fmt.Errorf("shardmap: unsupported index version %d", v)
+	}
+	count := binary.LittleEndian.Uint64(header[8:])
+	tableOff := binary.LittleEndian.Uint64(header[16:])
+	if tableOff < indexHeaderSize || tableOff > math.MaxInt64 || count > uint64(math.MaxInt) ||
+		count > (math.MaxInt64-tableOff)/8 {
+		return nil, ErrBadIndex
+	}
+	if count > 0 {
+		var b [8]byte
+		if err := readFull(r, b[:], int64(tableOff+(count-1)*8)); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil, ErrBadIndex
+			}
+			return nil, err
+		}
+	}
+	return &Index{
+		r:        r,
+		count:    int(count),
+		tableOff: int64(tableOff),
+	}, nil
+}
+
+// Len returns the number of entries in the index.
+func (x *Index) Len() int {
+	return x.count
+}
+
+// Lookup returns the value stored for key using a binary search over the offset
+// table. It returns false if key is not in the index. A read error from the
+// underlying io.ReaderAt is also reported as false.
+func (x *Index) Lookup(key string) ([]byte, bool) {
+	lo, hi := 0, x.count
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		off, k, vlen, err := x.record(mid)
+		if err != nil {
+			return nil, false
+		}
+		switch c := strings.Compare(k, key); {
+		case c < 0:
+			lo = mid + 1
+		case c > 0:
+			hi = mid
+		default:
+			value := make([]byte, vlen)
+			if err := readFull(x.r, value, off+recordHeadSize+int64(len(k))); err != nil {
+				return nil, false
+			}
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// record reads the offset, key and value length of the i'th record. A record that
+// does not lie between the header and the offset table is reported as ErrBadIndex.
+func (x *Index) record(i int) (off int64, key string, vlen int, err error) {
+	var b [8]byte
+	if err := readFull(x.r, b[:], x.tableOff+int64(i)*8); err != nil {
+		return 0, "", 0, err
+	}
+	end := uint64(x.tableOff) - recordHeadSize
+	pos := binary.LittleEndian.Uint64(b[:])
+	if pos < indexHeaderSize || pos > end {
+		return 0, "", 0, ErrBadIndex
+	}
+	off = int64(pos)
+	if err := readFull(x.r, b[:], off); err != nil {
+		return 0, "", 0, err
+	}
+	klen := binary.LittleEndian.Uint32(b[0:])
+	vlen = int(binary.LittleEndian.Uint32(b[4:]))
+	if uint64(klen)+uint64(vlen) > end-pos {
+		return 0, "", 0, ErrBadIndex
+	}
+	k := make([]byte, klen)
+	if err := readFull(x.r, k, off+recordHeadSize); err != nil {
+		return 0, "", 0, err
+	}
+	return off, string(k), vlen, nil
+}
+
+// readFull reads len(b) bytes at off. Unlike a bare ReadAt it accepts io.EOF along
+// with a full read, which io.ReaderAt allows at the end of the input.
+func readFull(r io.ReaderAt, b []byte, off int64) error {
+	n, err := r.ReadAt(b, off)
+	if n == len(b) {
+		return nil
+	}
+	if err == nil {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
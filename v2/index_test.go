@@ -0,0 +1,180 @@
+package shardmap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIndex(t *testing.T) {
+	m := New[string, []byte](0)
+	for i := 0; i < 1000; i++ {
+		m.Set(k(i), []byte("value-"+k(i)))
+	}
+	m.Set("empty", []byte{})
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "index"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := BuildIndex(m, f); err != nil {
+		t.Fatal(err)
+	}
+
+	x, err := OpenIndex(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.Len() != 1001 {
+		t.Fatalf("expected %v, got %v", 1001, x.Len())
+	}
+	for i := 0; i < 1000; i++ {
+		v, ok := x.Lookup(k(i))
+		if !ok || string(v) != "value-"+k(i) {
+			t.Fatalf("expected %v, got %v", "value-"+k(i), string(v))
+		}
+	}
+	if v, ok := x.Lookup("empty"); !ok || len(v) != 0 {
+		t.Fatalf("expected empty value, got %v, %v", v, ok)
+	}
+	for _, key := range []string{"", "-1", "1000", "zzz"} {
+		if _, ok := x.Lookup(key); ok {
+			t.Fatalf("expected %q to be missing", key)
+		}
+	}
+}
+
+func TestIndexEmpty(t *testing.T) {
+	var m Map[string, []byte]
+	f, err := os.Create(filepath.Join(t.TempDir(), "index"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := BuildIndex(&m, f); err != nil {
+		t.Fatal(err)
+	}
+	x, err := OpenIndex(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.Len() != 0 {
+		t.Fatalf("expected %v, got %v", 0, x.Len())
+	}
+	if _, ok := x.Lookup("a"); ok {
+		t.Fatal("expected false")
+	}
+}
+
+func TestOpenIndexBad(t *testing.T) {
+	for _, data := range [][]byte{nil, []byte("short"), bytes.Repeat([]byte("x"), indexHeaderSize)} {
+		if _, err := OpenIndex(bytes.NewReader(data)); err != ErrBadIndex {
+			t.Fatalf("expected %v, got %v", ErrBadIndex, err)
+		}
+	}
+}
+
+func TestOpenIndexTruncated(t *testing.T) {
+	m := New[string, []byte](0)
+	for i := 0; i < 100; i++ {
+		m.Set(k(i), []byte("value-"+k(i)))
+	}
+	f, err := os.Create(filepath.Join(t.TempDir(), "index"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := BuildIndex(m, f); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the offset table is last, so any cut past the header loses some of it
+	for n := indexHeaderSize; n < len(data); n++ {
+		if _, err := OpenIndex(bytes.NewReader(data[:n])); err != ErrBadIndex {
+			t.Fatalf("truncated to %d bytes: expected %v, got %v", n, ErrBadIndex, err)
+		}
+	}
+
+	// header fields pointing past the data
+	for _, field := range []struct {
+		off   int
+		value uint64
+	}{{8, 1 << 62}, {8, 1 << 20}, {16, 1 << 62}, {16, 0}} {
+		bad := bytes.Clone(data)
+		binary.LittleEndian.PutUint64(bad[field.off:], field.value)
+		if _, err := OpenIndex(bytes.NewReader(bad)); err != ErrBadIndex {
+			t.Fatalf("header %d set to %d: expected %v, got %v", field.off, field.value, ErrBadIndex, err)
+		}
+	}
+
+	// a record offset or length pointing past the records is not found
+	tableOff := binary.LittleEndian.Uint64(data[16:])
+	for _, corrupt := range []func(b []byte){
+		func(b []byte) { binary.LittleEndian.PutUint64(b[tableOff:], uint64(len(b))) },
+		func(b []byte) { binary.LittleEndian.PutUint32(b[indexHeaderSize+4:], 1<<31) },
+	} {
+		bad := bytes.Clone(data)
+		corrupt(bad)
+		x, err := OpenIndex(bytes.NewReader(bad))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := x.Lookup(k(0)); ok {
+			t.Fatalf("expected the corrupt record of %v to not be found", k(0))
+		}
+		if _, ok := x.Lookup(k(50)); !ok {
+			t.Fatalf("expected %v to be found", k(50))
+		}
+	}
+}
+
+// eofReader is a bytes.Reader whose reads report io.EOF along with the last bytes
+// of the data, as io.ReaderAt allows.
+type eofReader struct {
+	*bytes.Reader
+}
+
+func (r eofReader) ReadAt(b []byte, off int64) (int, error) {
+	n, err := r.Reader.ReadAt(b, off)
+	if err == nil && off+int64(n) == r.Size() {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func TestIndexEOFWithLastBytes(t *testing.T) {
+	for _, n := range []int{0, 10} {
+		m := New[string, []byte](0)
+		for i := 0; i < n; i++ {
+			m.Set(k(i), []byte("value-"+k(i)))
+		}
+		f, err := os.Create(filepath.Join(t.TempDir(), "index"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err := BuildIndex(m, f); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		x, err := OpenIndex(eofReader{bytes.NewReader(data)})
+		if err != nil {
+			t.Fatalf("%d entries: %v", n, err)
+		}
+		for i := 0; i < n; i++ {
+			if v, ok := x.Lookup(k(i)); !ok || string(v) != "value-"+k(i) {
+				t.Fatalf("expected %v, got %v", "value-"+k(i), string(v))
+			}
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package shardmap
+
+import "strings"
+
+// interner canonicalizes keys before they are stored.
+type interner[K comparable] interface {
+	// intern returns the canonical copy of key, creating it if needed.
+	intern(key K) K
+	// release drops the canonical copy of key.
+	release(key K)
+	// reset drops all canonical copies.
+	reset()
+	// fresh returns a new, empty interner of the same kind.
+	fresh() interner[K]
+}
+
+// WithStringInterning interns keys of a string keyed Map. The first time a key is
+// stored it is cloned into a private intern table (itself a Map) and every later
+// store of an equal key reuses that copy. Keys stored in the map therefore never pin
+// the backing array of a larger string they were sliced from, and all keys handed
+// back by the map (All, ShardIterator, ...) share a single allocation per key.
+//
+// Interning costs an extra hash and read locked lookup in the intern table on every
+// write, plus a clone and a write locked insert the first time a key is seen.
+// Deletes remove the key from the table. Reads are not affected.
+func WithStringInterning[V any]() Option[string, V] {
+	return func(m *Map[string, V]) {
+		m.interner = &stringInterner{}
+	}
+}
+
+// stringInterner is an interner for string keys.
+type stringInterner struct {
+	table Map[string, string]
+}
+
+func (s *stringInterner) intern(key string) string {
+	tab, shard := s.table.rlockKey(key)
+	v, ok := tab.maps[shard].Get(key)
+	tab.mus[shard].RUnlock()
+	if ok {
+		return v
+	}
+
+	tab, shard = s.table.lockKey(key)
+	defer tab.mus[shard].Unlock()
+	if v, ok := tab.maps[shard].Get(key); ok {
+		return v
+	}
+	key = strings.Clone(key)
+	tab.maps[shard].Set(key, key)
+	tab.counts[shard].Add(1)
+	return key
+}
+
+func (s *stringInterner) release(key string) {
+	s.table.Delete(key)
+}
+
+func (s *stringInterner) reset() {
+	s.table.Clear()
+}
+
+func (s *stringInterner) fresh() interner[string] {
+	return &stringInterner{}
+}
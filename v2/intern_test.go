@@ -0,0 +1,54 @@
+package shardmap
+
+import (
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+func TestStringInterning(t *testing.T) {
+	m := New[string, int](0, WithStringInterning[int]())
+
+	big := strings.Repeat("x", 1024) + "key"
+	key := big[len(big)-3:]
+	m.Set(key, 1)
+	m.Set(strings.Clone(key), 2)
+
+	if m.Len() != 1 {
+		t.Fatalf("expected %v, got %v", 1, m.Len())
+	}
+	if v, ok := m.Get("key"); !ok || v != 2 {
+		t.Fatalf("expected %v, got %v", 2, v)
+	}
+	var stored string
+	for k := range m.All() {
+		stored = k
+	}
+	if unsafe.StringData(stored) == unsafe.StringData(key) {
+		t.Fatal("stored key pins the original backing array")
+	}
+	canon, ok := m.interner.(*stringInterner).table.Get("key")
+	if !ok || unsafe.StringData(canon) != unsafe.StringData(stored) {
+		t.Fatal("stored key is not the interned copy")
+	}
+
+	m.SetAccept("rejected", 1, func(int, bool) bool { return false })
+	m.Delete("key")
+	if n := m.interner.(*stringInterner).table.Len(); n != 0 {
+		t.Fatalf("expected intern table to be empty, got %v", n)
+	}
+}
+
+func TestStringInterningSetIfAbsent(t *testing.T) {
+	m := New[string, int](0, WithStringInterning[int]())
+	m.Set("abc", 1)
+	if m.SetIfAbsent("abc", 2) {
+		t.Fatal("expected SetIfAbsent to not store over an existing key")
+	}
+	if m.Len() != 1 {
+		t.Fatalf("expected %v, got %v", 1, m.Len())
+	}
+	if _, ok := m.interner.(*stringInterner).table.Get("abc"); !ok {
+		t.Fatal("expected the intern table to still hold the key")
+	}
+}
@@ -0,0 +1,256 @@
+package shardmap
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// ShardIterator steps through the entries of a Map one at a time, shard by shard.
+// Unlike All or a range-func, the caller owns the pacing: it can stop calling Next,
+// do other work and resume later without holding any lock in between.
+//
+// When the iterator advances into a shard it takes that shard's read lock, copies
+// the shard's entries and releases the lock before returning. No lock is held
+// between calls to Next. This has consequences for concurrent modification:
+//
+//   - A change made to a shard after it was copied is not seen. Deleted entries
+//     may still be returned and new entries may be missed.
+//   - A change made to a shard that has not been reached yet is seen.
+//   - Operations that move entries between shards (for example changing the shard
+//     layout) may cause an entry to be returned twice or not at all.
+//
+// The iterator never observes a partially applied change within a single shard.
+// A ShardIterator is not safe for concurrent use by multiple goroutines.
+type ShardIterator[K comparable, V any] struct {
+	tab   *table[K, V]
+	shard int
+	buf   []kv[K, V]
+	pos   int
+}
+
+type kv[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// ShardIterator returns a new iterator positioned before the first entry of the map.
+// See ShardIterator for the consistency guarantees.
+func (m *Map[K, V]) ShardIterator() *ShardIterator[K, V] {
+	return &ShardIterator[K, V]{tab: m.table()}
+}
+
+// Next returns the next entry. It returns false when all shards have been visited.
+func (it *ShardIterator[K, V]) Next() (key K, value V, ok bool) {
+	for it.pos >= len(it.buf) {
+		if it.shard >= it.tab.shards {
+			it.buf = nil
+			return key, value, false
+		}
+		it.buf = it.tab.appendShard(it.buf[:0], it.shard)
+		it.pos = 0
+		it.shard++
+	}
+	e := it.buf[it.pos]
+	it.pos++
+	return e.key, e.value, true
+}
+
+// Entry is a key/value pair.
+type Entry[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+// RangeChunked calls fn with the map's entries in chunks of up to chunk entries
+// (a chunk < 1 is treated as 1). Iteration stops when fn returns false.
+//
+// Each chunk is copied from a shard under its read lock, and the lock is released
+// before fn is called, so no lock is held for longer than it takes to copy chunk
+// entries no matter how slow fn is, and fn may write to the map. The tradeoff is
+// consistency: each chunk is a snapshot of part of a shard, and changes made to a
+// shard between two of its chunks can shift entries within it, so an entry may be
+// missed or passed to fn twice. Entries that are not changed during the iteration
+// are only missed or repeated if the shard is reorganized by inserts or deletes.
+//
+// The slice passed to fn is reused for the next chunk; fn must not retain it.
+func (m *Map[K, V]) RangeChunked(chunk int, fn func([]Entry[K, V]) bool) {
+	tab := m.table()
+	chunk = max(chunk, 1)
+	buf := make([]Entry[K, V], 0, chunk)
+	add := func(key K, value V) bool {
+		buf = append(buf, Entry[K, V]{key, value})
+		return len(buf) < chunk
+	}
+	for i := 0; i < tab.shards; i++ {
+		for pos := 0; pos >= 0; {
+			buf = buf[:0]
+			tab.mus[i].RLock()
+			pos = tab.maps[i].ScanFrom(pos, add)
+			tab.mus[i].RUnlock()
+			if len(buf) > 0 && !fn(buf) {
+				return
+			}
+		}
+	}
+}
+
+// RangeErr calls fn for every key/value and stops at the first non-nil error fn
+// returns, which is then returned. It returns nil if every entry was visited. Each
+// shard's read lock is held while its entries are passed to fn and is released
+// even when fn returns an error or panics. fn must not write to the map.
+func (m *Map[K, V]) RangeErr(fn func(key K, value V) error) error {
+	tab := m.table()
+	for i := 0; i < tab.shards; i++ {
+		err := func() error {
+			tab.mus[i].RLock()
+			defer tab.mus[i].RUnlock()
+			for k, v := range tab.maps[i].All() {
+				if err := fn(k, v); err != nil {
+					return err
+				}
+			}
+			return nil
+		}()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RangeComplete calls fn for every key/value until fn returns false, and reports
+// whether every entry was visited: true if the iteration ran to the end, false if
+// fn stopped it. An empty map returns true. Each shard's read lock is held while
+// its entries are passed to fn, so fn must not write to the map.
+func (m *Map[K, V]) RangeComplete(fn func(key K, value V) bool) (completed bool) {
+	tab := m.table()
+	for i := 0; i < tab.shards; i++ {
+		stopped := func() bool {
+			tab.mus[i].RLock()
+			defer tab.mus[i].RUnlock()
+			for k, v := range tab.maps[i].All() {
+				if !fn(k, v) {
+					return true
+				}
+			}
+			return false
+		}()
+		if stopped {
+			return false
+		}
+	}
+	return true
+}
+
+// RangeKeys calls iter for every key until iter returns false. The values are
+// not read, so unlike a range over All that ignores them, no value is copied,
+// which matters when V is a large struct. Each shard's read lock is held while its
+// keys are passed to iter, so iter must not write to the map.
+func (m *Map[K, V]) RangeKeys(iter func(key K) bool) {
+	tab := m.table()
+	for i := 0; i < tab.shards; i++ {
+		stopped := func() bool {
+			tab.mus[i].RLock()
+			defer tab.mus[i].RUnlock()
+			for k := range tab.maps[i].AllKeys() {
+				if !iter(k) {
+					return true
+				}
+			}
+			return false
+		}()
+		if stopped {
+			return
+		}
+	}
+}
+
+// rangeCheckEvery is how many entries RangeContext visits between checks of its
+// context within a shard.
+const rangeCheckEvery = 1024
+
+// RangeContext calls iter for every key/value until iter returns false or ctx is
+// done, and returns ctx.Err() if the iteration was cut short by ctx, nil otherwise.
+// ctx is checked before each shard and every 1024 entries within a shard, so a
+// canceled scan stops after at most that many more calls of iter; iter itself is
+// not interrupted. Each shard's read lock is held while its entries are passed to
+// iter, so iter must not write to the map.
+func (m *Map[K, V]) RangeContext(ctx context.Context, iter func(key K, value V) bool) error {
+	tab := m.table()
+	for i := 0; i < tab.shards; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		stopped, err := func() (bool, error) {
+			tab.mus[i].RLock()
+			defer tab.mus[i].RUnlock()
+			var n int
+			for k, v := range tab.maps[i].All() {
+				if n++; n%rangeCheckEvery == 0 {
+					if err := ctx.Err(); err != nil {
+						return true, err
+					}
+				}
+				if !iter(k, v) {
+					return true, nil
+				}
+			}
+			return false, nil
+		}()
+		if stopped {
+			return err
+		}
+	}
+	return nil
+}
+
+// RangeParallel calls iter for every key/value, spreading the shards over up to
+// workers goroutines (runtime.GOMAXPROCS(0) if workers <= 0). Each worker holds a
+// shard's read lock while it passes the shard's entries to iter, so iter must not
+// write to the map, and iter is called from several goroutines at once, so it must
+// be safe for concurrent use.
+//
+// Returning false from iter stops the iteration: a shared flag is set, and every
+// worker stops as soon as it next checks it, which it does before each entry. Calls
+// already in progress on other workers still complete, so iter may be called a few
+// times after one call returned false. RangeParallel returns once all workers have
+// stopped.
+func (m *Map[K, V]) RangeParallel(workers int, iter func(key K, value V) bool) {
+	tab := m.table()
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	workers = min(workers, tab.shards)
+
+	var next atomic.Int64
+	var stop atomic.Bool
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for !stop.Load() {
+				shard := int(next.Add(1) - 1)
+				if shard >= tab.shards {
+					return
+				}
+				func() {
+					tab.mus[shard].RLock()
+					defer tab.mus[shard].RUnlock()
+					for k, v := range tab.maps[shard].All() {
+						if stop.Load() {
+							return
+						}
+						if !iter(k, v) {
+							stop.Store(true)
+							return
+						}
+					}
+				}()
+			}
+		}()
+	}
+	wg.Wait()
+}
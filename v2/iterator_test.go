@@ -0,0 +1,363 @@
+package shardmap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestShardIterator(t *testing.T) {
+	var m Map[string, int]
+	it := m.ShardIterator()
+	if _, _, ok := it.Next(); ok {
+		t.Fatal("expected false")
+	}
+
+	for i := 0; i < 1000; i++ {
+		m.Set(k(i), i)
+	}
+	seen := map[string]int{}
+	it = m.ShardIterator()
+	for {
+		key, value, ok := it.Next()
+		if !ok {
+			break
+		}
+		if _, ok := seen[key]; ok {
+			t.Fatalf("key %v returned twice", key)
+		}
+		seen[key] = value
+		// Writes between calls must not block on the iterator.
+		m.Set("other", -1)
+		m.Delete("other")
+	}
+	if len(seen) != 1000 {
+		t.Fatalf("expected %v, got %v", 1000, len(seen))
+	}
+	for i := 0; i < 1000; i++ {
+		if seen[k(i)] != i {
+			t.Fatalf("expected %v, got %v", i, seen[k(i)])
+		}
+	}
+	if _, _, ok := it.Next(); ok {
+		t.Fatal("expected false after exhaustion")
+	}
+}
+
+func TestRangeWithShard(t *testing.T) {
+	var m Map[string, int]
+	for i := 0; i < 1000; i++ {
+		m.Set(k(i), i)
+	}
+	var n int
+	m.RangeWithShard(func(shard int, key string, value int) bool {
+		if shard != m.choose(key) {
+			t.Fatalf("key %v: expected shard %v, got %v", key, m.choose(key), shard)
+		}
+		n++
+		return true
+	})
+	if n != 1000 {
+		t.Fatalf("expected %v, got %v", 1000, n)
+	}
+	n = 0
+	m.RangeWithShard(func(int, string, int) bool {
+		n++
+		return false
+	})
+	if n != 1 {
+		t.Fatalf("expected %v, got %v", 1, n)
+	}
+}
+
+func TestRangeShard(t *testing.T) {
+	m := New[string, int](0, WithShards[string, int](8))
+	for i := 0; i < 1000; i++ {
+		m.Set(k(i), i)
+	}
+	if m.Shards() != 8 {
+		t.Fatalf("expected %v, got %v", 8, m.Shards())
+	}
+	seen := map[string]int{}
+	for shard := 0; shard < m.Shards(); shard++ {
+		m.RangeShard(shard, func(key string, value int) bool {
+			if m.choose(key) != shard {
+				t.Fatalf("key %v: expected shard %v, got %v", key, m.choose(key), shard)
+			}
+			if _, ok := seen[key]; ok {
+				t.Fatalf("key %v returned twice", key)
+			}
+			seen[key] = value
+			return true
+		})
+		// only the visited shard was locked, and it is unlocked again
+		m.Set("other", -1)
+		m.Delete("other")
+	}
+	all := map[string]int{}
+	for key, value := range m.All() {
+		all[key] = value
+	}
+	if !maps.Equal(seen, all) {
+		t.Fatalf("expected the shards to hold the %v entries of Range, got %v", len(all), len(seen))
+	}
+
+	var n int
+	m.RangeShard(0, func(string, int) bool { n++; return false })
+	if n != 1 {
+		t.Fatalf("expected %v, got %v", 1, n)
+	}
+
+	for _, shard := range []int{-1, 8} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("RangeShard(%d): expected a panic", shard)
+				}
+			}()
+			m.RangeShard(shard, func(string, int) bool { return true })
+		}()
+	}
+}
+
+func TestRangeChunked(t *testing.T) {
+	var m Map[string, int]
+	for i := 0; i < 1000; i++ {
+		m.Set(k(i), i)
+	}
+	seen := map[string]int{}
+	m.RangeChunked(7, func(entries []Entry[string, int]) bool {
+		if len(entries) == 0 || len(entries) > 7 {
+			t.Fatalf("unexpected chunk size %v", len(entries))
+		}
+		for _, e := range entries {
+			if _, ok := seen[e.Key]; ok {
+				t.Fatalf("key %v returned twice", e.Key)
+			}
+			seen[e.Key] = e.Value
+		}
+		// no shard lock is held while fn runs
+		for i := range m.table().mus {
+			if !m.table().mus[i].TryLock() {
+				t.Fatalf("shard %d is locked", i)
+			}
+			m.table().mus[i].Unlock()
+		}
+		return true
+	})
+	if len(seen) != 1000 {
+		t.Fatalf("expected %v, got %v", 1000, len(seen))
+	}
+	for i := 0; i < 1000; i++ {
+		if seen[k(i)] != i {
+			t.Fatalf("expected %v, got %v", i, seen[k(i)])
+		}
+	}
+
+	var calls int
+	m.RangeChunked(0, func(entries []Entry[string, int]) bool {
+		calls++
+		if len(entries) != 1 {
+			t.Fatalf("expected %v, got %v", 1, len(entries))
+		}
+		return calls < 3
+	})
+	if calls != 3 {
+		t.Fatalf("expected %v, got %v", 3, calls)
+	}
+}
+
+func TestRangeErr(t *testing.T) {
+	var m Map[string, int]
+	for i := 0; i < 1000; i++ {
+		m.Set(k(i), i)
+	}
+	var n int
+	if err := m.RangeErr(func(string, int) error { n++; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1000 {
+		t.Fatalf("expected %v, got %v", 1000, n)
+	}
+
+	errStop := errors.New("stop")
+	n = 0
+	err := m.RangeErr(func(key string, value int) error {
+		n++
+		if n == 10 {
+			return errStop
+		}
+		return nil
+	})
+	if err != errStop {
+		t.Fatalf("expected %v, got %v", errStop, err)
+	}
+	if n != 10 {
+		t.Fatalf("expected %v, got %v", 10, n)
+	}
+	// the error of the key that failed is returned as is
+	err = m.RangeErr(func(key string, value int) error {
+		if value == 500 {
+			return fmt.Errorf("key %s: %w", key, errStop)
+		}
+		return nil
+	})
+	if want := "key " + k(500) + ": stop"; err == nil || err.Error() != want || !errors.Is(err, errStop) {
+		t.Fatalf("expected %v, got %v", want, err)
+	}
+
+	// the shard must have been unlocked
+	m.Set("after", 1)
+	if m.Len() != 1001 {
+		t.Fatalf("expected %v, got %v", 1001, m.Len())
+	}
+}
+
+func TestRangeComplete(t *testing.T) {
+	var m Map[string, int]
+	if !m.RangeComplete(func(string, int) bool { return false }) {
+		t.Fatal("expected an empty map to complete")
+	}
+	for i := 0; i < 1000; i++ {
+		m.Set(k(i), i)
+	}
+	var n int
+	if !m.RangeComplete(func(string, int) bool { n++; return true }) {
+		t.Fatal("expected true")
+	}
+	if n != 1000 {
+		t.Fatalf("expected %v, got %v", 1000, n)
+	}
+	n = 0
+	if m.RangeComplete(func(string, int) bool { n++; return n < 10 }) {
+		t.Fatal("expected false")
+	}
+	if n != 10 {
+		t.Fatalf("expected %v, got %v", 10, n)
+	}
+	// the last visited entry returning false still counts as stopped
+	n = 0
+	if m.RangeComplete(func(string, int) bool { n++; return n < 1000 }) {
+		t.Fatal("expected false")
+	}
+}
+
+func TestRangeKeys(t *testing.T) {
+	var m Map[string, int]
+	for i := 0; i < 1000; i++ {
+		m.Set(k(i), i)
+	}
+	seen := map[string]bool{}
+	m.RangeKeys(func(key string) bool {
+		if seen[key] {
+			t.Fatalf("key %v returned twice", key)
+		}
+		seen[key] = true
+		return true
+	})
+	if len(seen) != 1000 || !seen[k(999)] {
+		t.Fatalf("expected %v keys, got %v", 1000, len(seen))
+	}
+	var n int
+	m.RangeKeys(func(string) bool { n++; return false })
+	if n != 1 {
+		t.Fatalf("expected %v, got %v", 1, n)
+	}
+}
+
+func TestRangeContext(t *testing.T) {
+	var m Map[int, int]
+	for i := 0; i < 100000; i++ {
+		m.Set(i, i)
+	}
+	var n int
+	if err := m.RangeContext(context.Background(), func(int, int) bool { n++; return true }); err != nil {
+		t.Fatal(err)
+	}
+	if n != 100000 {
+		t.Fatalf("expected %v, got %v", 100000, n)
+	}
+	n = 0
+	if err := m.RangeContext(context.Background(), func(int, int) bool { n++; return n < 10 }); err != nil {
+		t.Fatalf("expected a stop by iter to return nil, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	n = 0
+	err := m.RangeContext(ctx, func(int, int) bool {
+		if n++; n == 1 {
+			<-ctx.Done()
+		}
+		return true
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if n >= rangeCheckEvery {
+		t.Fatalf("expected the scan to stop within %v entries, got %v", rangeCheckEvery, n)
+	}
+	// a done context visits nothing
+	n = 0
+	if err := m.RangeContext(ctx, func(int, int) bool { n++; return true }); err == nil || n != 0 {
+		t.Fatalf("expected an error and no calls, got %v and %v calls", err, n)
+	}
+}
+
+func TestRangeParallel(t *testing.T) {
+	var m Map[string, int]
+	for i := 0; i < 10000; i++ {
+		m.Set(k(i), i)
+	}
+	for _, workers := range []int{0, 1, 4, 1000} {
+		var mu sync.Mutex
+		seen := map[string]int{}
+		m.RangeParallel(workers, func(key string, value int) bool {
+			mu.Lock()
+			defer mu.Unlock()
+			seen[key]++
+			return true
+		})
+		if len(seen) != 10000 {
+			t.Fatalf("workers %d: expected %v, got %v", workers, 10000, len(seen))
+		}
+		for key, n := range seen {
+			if n != 1 {
+				t.Fatalf("workers %d: key %v visited %v times", workers, key, n)
+			}
+		}
+	}
+
+	var calls atomic.Int64
+	m.RangeParallel(4, func(string, int) bool {
+		return calls.Add(1) < 10
+	})
+	// each worker may finish a call already in progress
+	if n := calls.Load(); n < 10 || n > 10+4 {
+		t.Fatalf("expected about %v calls, got %v", 10, n)
+	}
+}
+
+func BenchmarkRangeKeys(b *testing.B) {
+	type large struct{ data [1024]byte }
+	var m Map[int, large]
+	for i := 0; i < 10000; i++ {
+		m.Set(i, large{})
+	}
+
+	b.Run("RangeKeys", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			m.RangeKeys(func(int) bool { return true })
+		}
+	})
+	b.Run("RangeComplete", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			m.RangeComplete(func(int, large) bool { return true })
+		}
+	})
+}
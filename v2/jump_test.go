@@ -0,0 +1,109 @@
+package shardmap
+
+import (
+	"hash/maphash"
+	"testing"
+)
+
+func TestJumpHash(t *testing.T) {
+	for _, buckets := range []int{1, 2, 5, 16, 1000} {
+		used := map[int]bool{}
+		for h := uint64(0); h < 10000; h++ {
+			b := jumpHash(mix64(h), buckets)
+			if b < 0 || b >= buckets {
+				t.Fatalf("jumpHash(%d buckets): got bucket %v", buckets, b)
+			}
+			used[b] = true
+		}
+		if want := min(buckets, 1000); len(used) != want {
+			t.Fatalf("jumpHash(%d buckets): expected %v buckets used, got %v", buckets, want, len(used))
+		}
+	}
+	// growing by one bucket only moves keys to the new bucket
+	for h := uint64(0); h < 10000; h++ {
+		if a, b := jumpHash(mix64(h), 16), jumpHash(mix64(h), 17); a != b && b != 16 {
+			t.Fatalf("hash %v: moved from bucket %v to %v", h, a, b)
+		}
+	}
+}
+
+func TestWithJumpHash(t *testing.T) {
+	if got := New[int, int](0, WithShards[int, int](5), WithJumpHash[int, int]()).table().shards; got != 5 {
+		t.Fatalf("expected %v, got %v", 5, got)
+	}
+	if got := New[int, int](0, WithJumpHash[int, int](), WithShards[int, int](1<<30)).table().shards; got != maxShards {
+		t.Fatalf("expected %v, got %v", maxShards, got)
+	}
+
+	// moved returns the fraction of keys that change shard when m is resized to n
+	moved := func(m *Map[int, int], n int) float64 {
+		for i := 0; i < 10000; i++ {
+			m.Set(i, i)
+		}
+		before := make([]int, 10000)
+		for i := range before {
+			before[i] = m.choose(i)
+		}
+		m.Resize(n)
+		var count int
+		for i := range before {
+			if v, ok := m.Get(i); !ok || v != i {
+				t.Fatalf("key %v: expected %v, got %v", i, i, v)
+			}
+			if m.choose(i) != before[i] {
+				count++
+			}
+		}
+		return float64(count) / 10000
+	}
+	jump := New[int, int](0, WithShards[int, int](16), WithJumpHash[int, int]())
+	if got := moved(jump, 17); got > 0.1 {
+		t.Fatalf("jump hashing: expected about 1/17 of the keys to move, got %v", got)
+	}
+	if jump.Shards() != 17 {
+		t.Fatalf("expected %v, got %v", 17, jump.Shards())
+	}
+	mask := New[int, int](0, WithShards[int, int](16))
+	if got := moved(mask, 17); got < 0.4 {
+		t.Fatalf("masking: expected about half of the keys to move, got %v", got)
+	}
+	if mask.Shards() != 32 {
+		t.Fatalf("expected %v, got %v", 32, mask.Shards())
+	}
+
+	// only maps that place keys the same way are shard aligned
+	seed := maphash.MakeSeed()
+	a := New[int, int](0, WithShards[int, int](16), WithSeed[int, int](seed))
+	b := New[int, int](0, WithShards[int, int](16), WithSeed[int, int](seed), WithJumpHash[int, int]())
+	if a.table().aligned(b.table()) || b.table().aligned(a.table()) {
+		t.Fatal("expected masking and jump hashing to not be aligned")
+	}
+	c := jump.NewLike()
+	if !c.table().aligned(jump.table()) {
+		t.Fatal("expected NewLike to be aligned")
+	}
+	c.LoadParallel(jump, 0)
+	for shard := 0; shard < c.Shards(); shard++ {
+		c.RangeShard(shard, func(key, value int) bool {
+			if jump.choose(key) != shard {
+				t.Fatalf("key %v: expected shard %v, got %v", key, jump.choose(key), shard)
+			}
+			return true
+		})
+	}
+}
+
+func BenchmarkChoose(b *testing.B) {
+	mask := New[int, int](0, WithShards[int, int](64))
+	jump := New[int, int](0, WithShards[int, int](64), WithJumpHash[int, int]())
+	b.Run("Mask", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			mask.choose(i)
+		}
+	})
+	b.Run("Jump", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			jump.choose(i)
+		}
+	})
+}
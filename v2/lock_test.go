@@ -0,0 +1,81 @@
+package shardmap
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+var lockStrategies = []struct {
+	name     string
+	strategy LockStrategy
+}{
+	{"RWMutex", LockRWMutex},
+	{"Mutex", LockMutex},
+	{"Spin", LockSpin},
+}
+
+func TestLockStrategy(t *testing.T) {
+	for _, ls := range lockStrategies {
+		m := New[int, int](0, WithLockStrategy[int, int](ls.strategy))
+		var wg sync.WaitGroup
+		for w := 0; w < 8; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < 1000; i++ {
+					key := w*1000 + i
+					m.Set(key, key)
+					if v, ok := m.Get(key); !ok || v != key {
+						t.Errorf("%s: expected %v, got %v", ls.name, key, v)
+						return
+					}
+					if i%2 == 0 {
+						m.Delete(key)
+					}
+				}
+			}(w)
+		}
+		wg.Wait()
+		if m.Len() != 4000 {
+			t.Fatalf("%s: expected %v, got %v", ls.name, 4000, m.Len())
+		}
+		for i := range m.table().mus {
+			if !m.table().mus[i].TryLock() {
+				t.Fatalf("%s: shard %d left locked", ls.name, i)
+			}
+			if m.table().mus[i].TryLock() {
+				t.Fatalf("%s: shard %d locked twice", ls.name, i)
+			}
+			m.table().mus[i].Unlock()
+		}
+	}
+}
+
+// BenchmarkLockStrategy compares the lock strategies for a range of read ratios.
+func BenchmarkLockStrategy(b *testing.B) {
+	const keys = 1 << 16
+	for _, ls := range lockStrategies {
+		for _, reads := range []int{10, 50, 90, 99} {
+			b.Run(fmt.Sprintf("%s/reads=%d%%", ls.name, reads), func(b *testing.B) {
+				m := New[int, int](keys, WithLockStrategy[int, int](ls.strategy))
+				for i := 0; i < keys; i++ {
+					m.Set(i, i)
+				}
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					r := rand.New(rand.NewSource(rand.Int63()))
+					for pb.Next() {
+						key := r.Intn(keys)
+						if r.Intn(100) < reads {
+							m.Get(key)
+						} else {
+							m.Set(key, key)
+						}
+					}
+				})
+			})
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package shardmap
+
+import (
+	"container/list"
+	"sync"
+
+	rhh "github.com/johnsiilver/shardmap/v2/hashmap"
+)
+
+// WithMaxEntries bounds the map to about n entries for use as a cache. When an
+// insert takes a shard over its share of n, the shard's least recently used entries
+// are deleted and the eviction handler is called for them with EvictOverflow (see
+// WithEvictionHandler). Storing a value and Get both count as a use.
+//
+// Recency is tracked per shard, so no global lock is needed, but eviction is
+// approximate: each of the map's shards holds at most n divided by the shard count
+// (rounded up, and at least 1) entries, and evicts its own least recently used
+// entry even if another shard holds an older one. Uneven hashing can therefore
+// evict entries before the map holds n. Use WithShards(1) for an exact LRU at the
+// cost of a single lock. The bound is restored right after the insert that broke
+// it, once the shard lock has been retaken, so concurrent readers can briefly see
+// one entry too many per shard. Rebuild and Resize forget the recency order.
+func WithMaxEntries[K comparable, V any](n int) Option[K, V] {
+	return func(m *Map[K, V]) {
+		m.maxEntries = max(n, 0)
+	}
+}
+
+// lru is the recency order of the keys of a shard. Writers update it under the
+// shard's write lock; Get only holds mu, so mu is always taken last.
+type lru[K comparable] struct {
+	mu    sync.Mutex
+	order list.List // of K, most recently used first
+	elems *rhh.Map[K, *list.Element]
+}
+
+// use marks key as the most recently used, adding it if it is new.
+func (l *lru[K]) use(key K) {
+	l.mu.Lock()
+	if e, ok := l.elems.Get(key); ok {
+		l.order.MoveToFront(e)
+	} else {
+		l.elems.Set(key, l.order.PushFront(key))
+	}
+	l.mu.Unlock()
+}
+
+// touch marks key as the most recently used if it is tracked.
+func (l *lru[K]) touch(key K) {
+	l.mu.Lock()
+	if e, ok := l.elems.Get(key); ok {
+		l.order.MoveToFront(e)
+	}
+	l.mu.Unlock()
+}
+
+func (l *lru[K]) remove(key K) {
+	l.mu.Lock()
+	if e, ok := l.elems.Delete(key); ok {
+		l.order.Remove(e)
+	}
+	l.mu.Unlock()
+}
+
+// oldest returns the least recently used key.
+func (l *lru[K]) oldest() (key K, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e := l.order.Back(); e != nil {
+		return e.Value.(K), true
+	}
+	return key, false
+}
+
+func (l *lru[K]) reset() {
+	l.mu.Lock()
+	l.order.Init()
+	l.elems = rhh.New[K, *list.Element](0)
+	l.mu.Unlock()
+}
+
+// overflows reports if a store, which replaced a value or not, can take its shard
+// over the bound of WithMaxEntries or WithMaxBytes. A store that replaces a value
+// only changes the byte size.
+func (m *Map[K, V]) overflows(replaced bool) bool {
+	return (!replaced && m.maxEntries > 0) || m.maxBytes > 0
+}
+
+// over reports if shard holds more entries or bytes than its bound allows.
+func (t *table[K, V]) over(shard int) bool {
+	if t.lruCap > 0 && t.counts[shard].Load() > int64(t.lruCap) {
+		return true
+	}
+	return t.bytes != nil && t.bytes[shard].Load() > t.byteCap
+}
+
+// trim evicts the least recently used entries of key's shard until the shard is
+// within its bound.
+func (m *Map[K, V]) trim(key K) {
+	tab, shard := m.lockKey(key)
+	m.trimLocked(tab, shard)
+}
+
+// trimShard is trim for a shard of a table the caller keeps current, see
+// holdTable.
+func (m *Map[K, V]) trimShard(tab *table[K, V], shard int) {
+	tab.mus[shard].Lock()
+	m.trimLocked(tab, shard)
+}
+
+// trimLocked does the work of trim with the shard's write lock held, and releases
+// it before calling the eviction handler.
+func (m *Map[K, V]) trimLocked(tab *table[K, V], shard int) {
+	evicted := m.evictLocked(tab, shard, nil)
+	tab.mus[shard].Unlock()
+	for _, e := range evicted {
+		m.afterRemove(e.key, e.value, EvictOverflow)
+	}
+}
+
+// evictLocked deletes the least recently used entries of shard until it is within
+// its bound and appends them to evicted. A key of the recency order that is no
+// longer in the shard is dropped from the order, so the loop always makes progress.
+// The caller must hold the shard's write lock, or own tab before it is published.
+func (m *Map[K, V]) evictLocked(tab *table[K, V], shard int, evicted []kv[K, V]) []kv[K, V] {
+	for tab.over(shard) {
+		key, ok := tab.lrus[shard].oldest()
+		if !ok {
+			break
+		}
+		if prev, ok := m.deleteLocked(tab, shard, key); ok {
+			evicted = append(evicted, kv[K, V]{key, prev})
+		} else {
+			tab.lrus[shard].remove(key)
+		}
+	}
+	return evicted
+}
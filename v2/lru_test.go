@@ -0,0 +1,158 @@
+package shardmap
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMaxEntries(t *testing.T) {
+	var evicted []string
+	m := New[string, int](0,
+		WithShards[string, int](1),
+		WithMaxEntries[string, int](3),
+		WithEvictionHandler(func(key string, value int, reason EvictReason) {
+			if reason == EvictOverflow {
+				evicted = append(evicted, key)
+			}
+		}),
+	)
+	m.Set("a", 1)
+	m.Set("b", 2)
+	m.Set("c", 3)
+	if len(evicted) != 0 {
+		t.Fatalf("expected no evictions, got %v", evicted)
+	}
+
+	// a is the oldest entry, but is used again
+	m.Get("a")
+	m.Set("d", 4)
+	if len(evicted) != 1 || evicted[0] != "b" {
+		t.Fatalf("expected %v, got %v", []string{"b"}, evicted)
+	}
+	if m.Len() != 3 {
+		t.Fatalf("expected %v, got %v", 3, m.Len())
+	}
+	if _, ok := m.Get("b"); ok {
+		t.Fatal("expected b to be evicted")
+	}
+
+	// replacing a value uses it without evicting
+	m.Set("c", 30)
+	m.GetOrSet("e", 5)
+	m.SetMany(map[string]int{"f": 6})
+	if want := []string{"b", "a", "d"}; len(evicted) != 3 || evicted[1] != want[1] || evicted[2] != want[2] {
+		t.Fatalf("expected %v, got %v", want, evicted)
+	}
+	for _, key := range []string{"c", "e", "f"} {
+		if _, ok := m.Get(key); !ok {
+			t.Fatalf("key %v: expected to be present", key)
+		}
+	}
+
+	// deleted keys are not evicted later
+	m.Delete("c")
+	m.Set("g", 7)
+	m.Set("h", 8)
+	if len(evicted) != 4 || evicted[3] != "e" {
+		t.Fatalf("expected e to be evicted, got %v", evicted)
+	}
+}
+
+func TestMaxEntriesStaleKey(t *testing.T) {
+	m := New[string, int](0, WithShards[string, int](1), WithMaxEntries[string, int](1))
+	m.Set("a", 1)
+	// a key the recency order holds but the shard does not is the oldest
+	m.table().lrus[0].use("ghost")
+	m.Get("a")
+
+	done := make(chan struct{})
+	go func() {
+		m.Set("b", 2)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Set to return, trimming the shard did not end")
+	}
+	if _, ok := m.Get("a"); ok || m.Len() != 1 {
+		t.Fatalf("expected a to be evicted and %v entry left, got Len %v", 1, m.Len())
+	}
+	if key, _ := m.table().lrus[0].oldest(); key != "b" {
+		t.Fatalf("expected the stale key to be dropped, got oldest %v", key)
+	}
+}
+
+func TestMaxEntriesSharded(t *testing.T) {
+	m := New[string, int](0, WithShards[string, int](4), WithMaxEntries[string, int](100))
+	for i := 0; i < 1000; i++ {
+		m.Set(k(i), i)
+	}
+	tab := m.table()
+	if tab.lruCap != 25 {
+		t.Fatalf("expected %v, got %v", 25, tab.lruCap)
+	}
+	for i, n := range m.ShardSizes() {
+		if n > tab.lruCap {
+			t.Fatalf("shard %d: expected at most %v entries, got %v", i, tab.lruCap, n)
+		}
+	}
+	// the newest key of a shard always survives
+	if _, ok := m.Get(k(999)); !ok {
+		t.Fatal("expected the last key to be present")
+	}
+
+	// more shards give each a smaller share, which Resize enforces right away
+	m.Resize(16)
+	tab = m.table()
+	if tab.lruCap != 7 {
+		t.Fatalf("expected %v, got %v", 7, tab.lruCap)
+	}
+	for i, n := range m.ShardSizes() {
+		if n > tab.lruCap {
+			t.Fatalf("shard %d: expected at most %v entries after Resize, got %v", i, tab.lruCap, n)
+		}
+	}
+
+	m.Resize(2)
+	for i := 0; i < 1000; i++ {
+		m.Set(k(i), i)
+	}
+	if m.table().lruCap != 50 {
+		t.Fatalf("expected %v, got %v", 50, m.table().lruCap)
+	}
+	if m.Len() > 100 {
+		t.Fatalf("expected at most %v, got %v", 100, m.Len())
+	}
+}
+
+func TestMaxEntriesConcurrent(t *testing.T) {
+	var evicted atomic.Int64
+	m := New[int, int](0,
+		WithShards[int, int](4),
+		WithMaxEntries[int, int](64),
+		WithEvictionHandler(func(key int, value int, reason EvictReason) {
+			evicted.Add(1)
+		}),
+	)
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				m.Set(w*1000+i, i)
+				m.Get(w*1000 + i/2)
+			}
+		}(w)
+	}
+	wg.Wait()
+	if m.Len() > 64 {
+		t.Fatalf("expected at most %v, got %v", 64, m.Len())
+	}
+	if got := evicted.Load() + int64(m.Len()); got != 4000 {
+		t.Fatalf("expected %v entries stored, got %v", 4000, got)
+	}
+}
@@ -3,149 +3,927 @@
 package shardmap
 
 import (
+	"errors"
+	"fmt"
 	"hash/maphash"
 	"iter"
 	"runtime"
+	"slices"
 	"sync"
+	"sync/atomic"
 
 	rhh "github.com/johnsiilver/shardmap/v2/hashmap"
 )
 
+const (
+	// maxShards bounds the shard count no matter how many CPUs are reported.
+	maxShards = 1 << 16
+	// maxShardCap bounds the capacity a shard is created with, which keeps the
+	// sizing math of the underlying map from overflowing on huge capacities.
+	maxShardCap = 1 << 30
+)
+
+// numProcs reports how many goroutines can run in parallel, which the default
+// shard count is derived from. Tests replace it.
+var numProcs = gomaxprocs
+
+// gomaxprocs returns runtime.GOMAXPROCS(0). It is read when a map is initialized
+// rather than cached, as it can be changed at run time, and unlike
+// runtime.NumCPU it reflects the CPU quota of a constrained container.
+func gomaxprocs() int {
+	return runtime.GOMAXPROCS(0)
+}
+
 // Map is a hashmap. Like map[string]interface{}, but sharded and thread-safe.
 type Map[K comparable, V any] struct {
 	init   sync.Once
-	cap    int
-	shards int
-	mus    []sync.RWMutex
-	maps   []*rhh.Map[K, V]
+	cap    atomic.Int64 // set by New and Reset, never negative
+	minCap int          // minimum capacity of a shard, see WithShardCapacity
+	tab    atomic.Pointer[table[K, V]]
+	layout gate // held while every shard is visited, see table
+
+	shards       int                // shard count of the first table, 0 for the default
+	seed         maphash.Seed       // seed of the first table, chosen at random if zero
+	hasher       func(key K) uint64 // replaces maphash and seed when set
+	fixedSeed    bool               // hasher is fixedHash
+	jump         bool               // shards are picked by jumpHash, see WithJumpHash
+	trackRevs    bool
+	trackTimes   bool
+	maxEntries   int // bound on the entry count, see WithMaxEntries
+	sizeOf       func(key K, value V) int64
+	maxBytes     int64 // bound on the sum of sizeOf, see WithMaxBytes
+	shardFn      func(key K, numShards int) int
+	interner     interner[K]
+	card         *hll
+	lockStrategy LockStrategy
+	onEvict      func(key K, value V, reason EvictReason)
+	onSet        func(key K, newV V, oldV V, replaced bool)
+	onDelete     func(key K, oldV V, deleted bool)
+	feed         feed[K, V]
 
-	seed maphash.Seed
+	readOnly atomic.Bool
+	popNext  atomic.Uint64 // first shard the next Pop looks at
 
 	zeroV V
 }
 
+// counter is a shard's entry count. It is padded to keep counters of neighboring
+// shards off the same cache line.
+type counter struct {
+	atomic.Int64
+	_ [56]byte
+}
+
 // New returns a new hashmap with the specified capacity. This function is only
 // needed when you must define a minimum capacity, otherwise just use:
 //
 //	var m shardmap.Map
-func New[K comparable, V any](cap int) *Map[K, V] {
-	return &Map[K, V]{cap: cap}
+//
+// A negative capacity is treated as zero.
+func New[K comparable, V any](cap int, opts ...Option[K, V]) *Map[K, V] {
+	if cap < 0 {
+		cap = 0
+	}
+	m := &Map[K, V]{}
+	m.cap.Store(int64(cap))
+	for _, o := range opts {
+		o(m)
+	}
+	return m
 }
 
-// Clear out all values from map
+// NewLike returns a new, empty Map with the same capacity, options, shard count and
+// seed as m. A key lands on the same shard index in both maps, which lets
+// operations between them work shard by shard (see LoadParallel), unless m uses
+// WithHasher.
+func (m *Map[K, V]) NewLike() *Map[K, V] {
+	tab := m.table()
+	n := &Map[K, V]{
+		minCap:       m.minCap,
+		maxEntries:   m.maxEntries,
+		maxBytes:     m.maxBytes,
+		sizeOf:       m.sizeOf,
+		shards:       tab.shards,
+		seed:         tab.seed,
+		hasher:       m.hasher,
+		fixedSeed:    m.fixedSeed,
+		jump:         m.jump,
+		trackRevs:    m.trackRevs,
+		trackTimes:   m.trackTimes,
+		shardFn:      m.shardFn,
+		onEvict:      m.onEvict,
+		onSet:        m.onSet,
+		onDelete:     m.onDelete,
+		lockStrategy: m.lockStrategy,
+	}
+	n.cap.Store(m.cap.Load())
+	if m.interner != nil {
+		n.interner = m.interner.fresh()
+	}
+	if m.card != nil {
+		n.card = newHLL()
+	}
+	n.initDo()
+	return n
+}
+
+// Clone returns a new Map with the same configuration as m (see NewLike) holding
+// a copy of every entry of m, so keys are placed on the same shards. The two maps
+// are independent: a later write to either does not affect the other. Values are
+// copied by assignment, so values holding references, such as slices, maps or
+// pointers, share what they refer to. Each shard of m is copied under its read
+// lock, so writes to m during Clone may or may not be included. Revisions and
+// store times (WithRevisions, WithTimestamps) are those of the copy, not of m.
+func (m *Map[K, V]) Clone() *Map[K, V] {
+	n := m.NewLike()
+	n.LoadParallel(m, 0)
+	return n
+}
+
+// Filter returns a new Map, created with NewLike, holding the entries of m for
+// which keep returns true. Each shard of m is walked under its read lock, so keep
+// must not write to m, and the result is consistent per shard but not across
+// shards. As the new map shares m's shard layout, the kept entries of a shard are
+// stored in the same shard of the result under a single lock.
+func (m *Map[K, V]) Filter(keep func(key K, value V) bool) *Map[K, V] {
+	n := m.NewLike()
+	tab := m.table()
+	ntab := n.holdTable()
+	defer n.layout.exit()
+	aligned := ntab.aligned(tab)
+	var buf []kv[K, V]
+	for i := 0; i < tab.shards; i++ {
+		buf = buf[:0]
+		tab.mus[i].RLock()
+		for k, v := range tab.maps[i].All() {
+			if keep(k, v) {
+				buf = append(buf, kv[K, V]{k, v})
+			}
+		}
+		tab.mus[i].RUnlock()
+		if aligned {
+			n.loadShard(ntab, i, buf, nil)
+			continue
+		}
+		for _, e := range buf {
+			n.Set(e.key, e.value)
+		}
+	}
+	return n
+}
+
+// Clear out all values from map. If an eviction handler is registered it is called
+// with EvictCleared for every discarded entry, after the entry's shard has been
+// unlocked. Without a handler the shards are simply reallocated.
 func (m *Map[K, V]) Clear() {
-	m.initDo()
-	for i := 0; i < m.shards; i++ {
-		m.mus[i].Lock()
-		m.maps[i] = rhh.New[K, V](m.cap / m.shards)
-		m.mus[i].Unlock()
+	m.checkWrite()
+	tab := m.holdTable()
+	defer m.layout.exit()
+	for i := 0; i < tab.shards; i++ {
+		tab.mus[i].Lock()
+		m.publishCleared(tab, i)
+		old := tab.maps[i]
+		tab.maps[i] = rhh.New[K, V](m.shardCap(tab.shards))
+		tab.counts[i].Store(0)
+		tab.negs[i] = nil
+		tab.grown[i] = nil
+		m.resetMetaLocked(tab, i, false)
+		tab.mus[i].Unlock()
+		if m.onEvict != nil || m.onDelete != nil {
+			for k, v := range old.All() {
+				m.notifyRemove(k, v, EvictCleared)
+			}
+		}
+	}
+	if m.interner != nil {
+		m.interner.reset()
+	}
+	if m.card != nil {
+		m.card.reset()
+	}
+}
+
+// Reset removes all values like Clear and makes newCap the capacity of the map:
+// the shards are reallocated for newCap entries, as New would create them, and
+// Clear reuses newCap from then on. This suits a map whose expected size changes a
+// lot between phases of a program, shrinking one that was once large or
+// presizing one about to be filled. A negative newCap is treated as zero.
+func (m *Map[K, V]) Reset(newCap int) {
+	m.checkWrite()
+	m.cap.Store(int64(max(newCap, 0)))
+	m.Clear()
+}
+
+// ResetKeep removes all values like Clear, but empties each shard in place instead
+// of reallocating it. The shards keep the capacity they have grown to and the map
+// stays initialized, which makes a Map cheap to reuse from a sync.Pool: refilling
+// it to a similar size does not allocate. Use Clear to release the memory instead.
+// If an eviction handler is registered it is called with EvictCleared for every
+// discarded entry.
+func (m *Map[K, V]) ResetKeep() {
+	m.checkWrite()
+	tab := m.holdTable()
+	defer m.layout.exit()
+	var cleared []kv[K, V]
+	for i := 0; i < tab.shards; i++ {
+		tab.mus[i].Lock()
+		m.publishCleared(tab, i)
+		if m.onEvict != nil || m.onDelete != nil {
+			cleared = cleared[:0]
+			for k, v := range tab.maps[i].All() {
+				cleared = append(cleared, kv[K, V]{k, v})
+			}
+		}
+		tab.maps[i].Clear()
+		tab.counts[i].Store(0)
+		tab.negs[i] = nil
+		tab.grown[i] = nil
+		m.resetMetaLocked(tab, i, true)
+		tab.mus[i].Unlock()
+		for _, e := range cleared {
+			m.notifyRemove(e.key, e.value, EvictCleared)
+		}
+	}
+	if m.interner != nil {
+		m.interner.reset()
+	}
+	if m.card != nil {
+		m.card.reset()
+	}
+}
+
+// ErrReadOnly is the value write methods panic with on a map marked read-only with
+// SetReadOnly.
+var ErrReadOnly = errors.New("shardmap: write to read-only map")
+
+// Shrink reallocates every shard to the smallest size that holds its entries,
+// to give back the memory of a map after most of its entries were deleted, such as
+// after an eviction storm. A shard otherwise only shrinks once it is mostly empty,
+// and never below its capacity from New or WithShardCapacity, which Shrink gives
+// up as well. Each shard is copied under its write lock, which blocks the shard's
+// readers and writers while it runs, so Shrink is O(n) and best called when the
+// map is quiet.
+func (m *Map[K, V]) Shrink() {
+	m.checkWrite()
+	tab := m.holdTable()
+	defer m.layout.exit()
+	for i := 0; i < tab.shards; i++ {
+		tab.mus[i].Lock()
+		tab.maps[i].Shrink()
+		tab.mus[i].Unlock()
+	}
+}
+
+// Grow makes room for about n more entries before a bulk load, so the shards do
+// not grow one by one, each rehashing under its write lock, as the entries arrive.
+// Each shard gets room for its share of n on top of the entries it holds; as keys
+// are not spread perfectly evenly, a few shards may still grow once. Unlike the
+// capacity given to New or Reset this applies to a map in use, and a shard that
+// already has room is left alone. A shard that must grow is copied under its write
+// lock. n <= 0 does nothing.
+func (m *Map[K, V]) Grow(n int) {
+	m.checkWrite()
+	if n <= 0 {
+		return
+	}
+	tab := m.holdTable()
+	defer m.layout.exit()
+	per := (n + tab.shards - 1) / tab.shards
+	for i := 0; i < tab.shards; i++ {
+		tab.mus[i].Lock()
+		tab.maps[i].Grow(per)
+		tab.mus[i].Unlock()
+	}
+}
+
+// SetReadOnly marks the map read-only, or writable again. While read-only every
+// method that would change the map (Set, Delete, Clear and the like) panics with
+// ErrReadOnly before changing anything; reads are unaffected. Writes never fail
+// silently, since most of them have no way to return an error, and recovering
+// the panic and comparing it to ErrReadOnly identifies the violation.
+//
+// The flag is a single atomic load per write. Writes that were already running
+// when the map is marked read-only may still complete.
+func (m *Map[K, V]) SetReadOnly(readOnly bool) {
+	m.readOnly.Store(readOnly)
+}
+
+// checkWrite panics if the map is read-only.
+func (m *Map[K, V]) checkWrite() {
+	if m.readOnly.Load() {
+		panic(ErrReadOnly)
 	}
 }
 
 // Set assigns a value to a key.
 // Returns the previous value, or false when no value was assigned.
 func (m *Map[K, V]) Set(key K, value V) (prev V, replaced bool) {
-	m.initDo()
-	shard := m.choose(key)
-	m.mus[shard].Lock()
-	prev, replaced = m.maps[shard].Set(key, value)
-	m.mus[shard].Unlock()
+	m.checkWrite()
+	if m.interner != nil {
+		key = m.interner.intern(key)
+	}
+	tab, shard := m.lockKey(key)
+	prev, replaced = m.setLocked(tab, shard, key, value)
+	tab.mus[shard].Unlock()
+	m.afterSet(key, value, prev, replaced)
 	return prev, replaced
 }
 
+// SetNotify assigns value to key like Set and calls onChange with the replaced
+// value and whether the key existed. onChange runs under the shard write lock,
+// right after the store, so notifications for the same key are delivered in the
+// order the writes happened. Because of the lock onChange must not call into the
+// map. Returns the previous value, or false when no value was assigned.
+func (m *Map[K, V]) SetNotify(key K, value V, onChange func(old V, existed bool)) (prev V, existed bool) {
+	m.checkWrite()
+	if m.interner != nil {
+		key = m.interner.intern(key)
+	}
+	func() {
+		tab, shard := m.lockKey(key)
+		defer tab.mus[shard].Unlock()
+		prev, existed = m.setLocked(tab, shard, key, value)
+		onChange(prev, existed)
+	}()
+	m.afterSet(key, value, prev, existed)
+	return prev, existed
+}
+
 // SetAccept assigns a value to a key. The "accept" function can be used to
 // inspect the previous value, if any, and accept or reject the change.
 // It's also provides a safe way to block other others from writing to the
 // same shard while inspecting.
 // Returns the previous value, or false when no value was assigned.
 func (m *Map[K, V]) SetAccept(key K, value V, accept func(prev V, replaced bool) bool) (prev V, replaced bool) {
-	m.initDo()
-	shard := m.choose(key)
-	m.mus[shard].Lock()
-	defer m.mus[shard].Unlock()
-	prev, replaced = m.maps[shard].Set(key, value)
-	if accept != nil {
-		if !accept(prev, replaced) {
-			// revert unaccepted change
-			if !replaced {
-				// delete the newly set data
-				m.maps[shard].Delete(key)
-			} else {
-				// reset updated data
-				m.maps[shard].Set(key, prev)
+	m.checkWrite()
+	if accept == nil {
+		return m.setAccept(key, value, nil)
+	}
+	return m.setAccept(key, value, func(_ *table[K, V], _ int, prev V, replaced bool) bool {
+		return accept(prev, replaced)
+	})
+}
+
+// setAccept is SetAccept with accept also given the table and shard of key.
+func (m *Map[K, V]) setAccept(key K, value V, accept func(tab *table[K, V], shard int, prev V, replaced bool) bool) (prev V, replaced bool) {
+	if m.interner != nil {
+		key = m.interner.intern(key)
+	}
+	accepted, existed := true, false
+	func() {
+		tab, shard := m.lockKey(key)
+		defer tab.mus[shard].Unlock()
+		if accept != nil {
+			// the change is only applied once accepted, so there is nothing to revert
+			var cur V
+			cur, existed = tab.maps[shard].Get(key)
+			if !accept(tab, shard, cur, existed) {
+				accepted = false
+				return
 			}
-			prev, replaced = m.zeroV, false
 		}
+		prev, replaced = m.setLocked(tab, shard, key, value)
+	}()
+	if !accepted {
+		if !existed && m.interner != nil {
+			m.interner.release(key)
+		}
+		return m.zeroV, false
 	}
+	m.afterSet(key, value, prev, replaced)
 	return prev, replaced
 }
 
+// SetIf stores value for key only if cond, called with the current value and
+// whether the key exists, returns true. It returns the value held before the call
+// and whether value was stored. This covers the usual conditional writes, such as
+// set if absent (!exists), set if present (exists) or set if greater
+// (!exists || value > old).
+//
+// cond runs while the key's shard is write locked, so the check and the store are
+// atomic, but cond must be quick and must not call into the map.
+func (m *Map[K, V]) SetIf(key K, value V, cond func(old V, exists bool) bool) (old V, set bool) {
+	m.checkWrite()
+	if m.interner != nil {
+		key = m.interner.intern(key)
+	}
+	var exists bool
+	func() {
+		tab, shard := m.lockKey(key)
+		defer tab.mus[shard].Unlock()
+		old, exists = tab.maps[shard].Get(key)
+		if !cond(old, exists) {
+			return
+		}
+		m.setLocked(tab, shard, key, value)
+		set = true
+	}()
+	switch {
+	case set:
+		m.afterSet(key, value, old, exists)
+	case !exists && m.interner != nil:
+		m.interner.release(key)
+	}
+	return old, set
+}
+
+// Replace overwrites the value of key only if key is already present, returning
+// the old value and true. If key is absent the map is not changed and false is
+// returned, so Replace never creates an entry.
+func (m *Map[K, V]) Replace(key K, value V) (old V, ok bool) {
+	m.checkWrite()
+	tab, shard := m.lockKey(key)
+	if _, ok = tab.maps[shard].Get(key); ok {
+		old, _ = m.setLocked(tab, shard, key, value)
+	}
+	tab.mus[shard].Unlock()
+	if ok {
+		m.afterSet(key, value, old, true)
+	}
+	return old, ok
+}
+
+// SetIfPresent stores value for key only if key is already present, returning
+// the value it replaced and true. An absent key is left absent. It is Replace under
+// the name that pairs with SetIfAbsent.
+func (m *Map[K, V]) SetIfPresent(key K, value V) (prev V, replaced bool) {
+	return m.Replace(key, value)
+}
+
+// GetAndRefresh replaces the value of a present key with fn(old) and returns the
+// new value and true, all under a single hold of the key's shard write lock, so a
+// concurrent Set cannot land between the read and the write. It suits touch on
+// read caches that bump an access time or extend a deadline on each hit. If key is
+// absent fn is not called, the map is not changed and false is returned.
+//
+// fn runs while the key's shard is write locked; it must not call into the map.
+func (m *Map[K, V]) GetAndRefresh(key K, fn func(old V) V) (value V, ok bool) {
+	m.checkWrite()
+	var old V
+	func() {
+		tab, shard := m.lockKey(key)
+		defer tab.mus[shard].Unlock()
+		if old, ok = tab.maps[shard].Get(key); !ok {
+			return
+		}
+		value = fn(old)
+		m.setLocked(tab, shard, key, value)
+	}()
+	if ok {
+		m.afterSet(key, value, old, true)
+	}
+	return value, ok
+}
+
+// GetOrSet returns the value of key if it is present, with loaded set. Otherwise
+// it stores value and returns it with loaded false. The lookup and the store are
+// done under a single hold of the key's shard lock, like sync.Map's LoadOrStore,
+// so concurrent callers agree on which value won.
+func (m *Map[K, V]) GetOrSet(key K, value V) (actual V, loaded bool) {
+	m.checkWrite()
+	if m.interner != nil {
+		key = m.interner.intern(key)
+	}
+	tab, shard := m.lockKey(key)
+	if actual, loaded = tab.maps[shard].Get(key); !loaded {
+		m.setLocked(tab, shard, key, value)
+		actual = value
+	}
+	tab.mus[shard].Unlock()
+	if !loaded {
+		m.afterSet(key, actual, m.zeroV, false)
+	}
+	return actual, loaded
+}
+
+// SetIfAbsent stores value for key only if key is not present, and reports
+// whether it did. Unlike GetOrSet the existing value is not returned, so it is not
+// copied when V is large. The check and the store are done under a single hold of
+// the key's shard lock.
+func (m *Map[K, V]) SetIfAbsent(key K, value V) bool {
+	m.checkWrite()
+	if m.interner != nil {
+		key = m.interner.intern(key)
+	}
+	tab, shard := m.lockKey(key)
+	exists := tab.maps[shard].Contains(key)
+	if !exists {
+		m.setLocked(tab, shard, key, value)
+	}
+	tab.mus[shard].Unlock()
+	if !exists {
+		m.afterSet(key, value, m.zeroV, false)
+	}
+	return !exists
+}
+
+// GetOrCompute is GetOrSet with the value built by fn, which is only called when
+// key is absent. fn runs at most once per call and never when key is present, so an
+// expensive value is not constructed just to be thrown away.
+//
+// fn runs while the key's shard is write locked; it must not call into the map.
+func (m *Map[K, V]) GetOrCompute(key K, fn func() V) (actual V, loaded bool) {
+	m.checkWrite()
+	if m.interner != nil {
+		key = m.interner.intern(key)
+	}
+	func() {
+		tab, shard := m.lockKey(key)
+		defer tab.mus[shard].Unlock()
+		if actual, loaded = tab.maps[shard].Get(key); !loaded {
+			actual = fn()
+			m.setLocked(tab, shard, key, actual)
+		}
+	}()
+	if !loaded {
+		m.afterSet(key, actual, m.zeroV, false)
+	}
+	return actual, loaded
+}
+
+// Update does a read-modify-write of key under a single hold of its shard's write
+// lock. fn is passed the current value and whether key is present, and returns the
+// new value and whether to store it. If store is false the map is left unchanged;
+// in particular a present key is not deleted. Update returns the value now stored
+// for key and whether fn's value was stored. When nothing was stored, the value is
+// the current one, or the zero value if key is absent.
+//
+// fn runs while the key's shard is write locked; it must not call into the map.
+func (m *Map[K, V]) Update(key K, fn func(old V, ok bool) (new V, store bool)) (V, bool) {
+	m.checkWrite()
+	if m.interner != nil {
+		key = m.interner.intern(key)
+	}
+	var cur, prev V
+	var exists, stored bool
+	func() {
+		tab, shard := m.lockKey(key)
+		defer tab.mus[shard].Unlock()
+		cur, exists = tab.maps[shard].Get(key)
+		next, store := fn(cur, exists)
+		if !store {
+			return
+		}
+		prev, _ = m.setLocked(tab, shard, key, next)
+		cur, stored = next, true
+	}()
+	switch {
+	case stored:
+		m.afterSet(key, cur, prev, exists)
+	case !exists && m.interner != nil:
+		m.interner.release(key)
+	}
+	return cur, stored
+}
+
+// Swap stores value for key and returns the value it replaced, with loaded set if
+// key was present. It matches sync.Map's Swap and is otherwise the same as Set.
+func (m *Map[K, V]) Swap(key K, value V) (previous V, loaded bool) {
+	return m.Set(key, value)
+}
+
 // Get returns a value for a key.
 // Returns false when no value has been assign for key.
 func (m *Map[K, V]) Get(key K) (value V, ok bool) {
-	m.initDo()
-	shard := m.choose(key)
-	m.mus[shard].RLock()
-	value, ok = m.maps[shard].Get(key)
-	m.mus[shard].RUnlock()
+	tab, shard := m.rlockKey(key)
+	value, ok = tab.maps[shard].Get(key)
+	tab.mus[shard].RUnlock()
+	if ok && tab.lrus != nil {
+		tab.lrus[shard].touch(key)
+	}
 	return value, ok
 }
 
+// Contains reports whether key has a value. Unlike Get it does not copy the value,
+// which matters when V is a large struct.
+func (m *Map[K, V]) Contains(key K) bool {
+	tab, shard := m.rlockKey(key)
+	ok := tab.maps[shard].Contains(key)
+	tab.mus[shard].RUnlock()
+	return ok
+}
+
 // Delete deletes a value for a key.
 // Returns the deleted value, or false when no value was assigned.
 func (m *Map[K, V]) Delete(key K) (prev V, deleted bool) {
-	m.initDo()
-	shard := m.choose(key)
-	m.mus[shard].Lock()
-	prev, deleted = m.maps[shard].Delete(key)
-	m.mus[shard].Unlock()
+	m.checkWrite()
+	tab, shard := m.lockKey(key)
+	prev, deleted = m.deleteLocked(tab, shard, key)
+	tab.mus[shard].Unlock()
+	if deleted {
+		m.afterDelete(key, prev)
+	} else if m.onDelete != nil {
+		m.onDelete(key, prev, false)
+	}
 	return prev, deleted
 }
 
+// LoadAndDelete deletes the value for key and returns it, with loaded set if key
+// was present. The read and the removal happen under a single hold of the key's
+// shard lock, so when several goroutines race to take the same key exactly one of
+// them gets it, which suits work-queue style consumption. It matches sync.Map's
+// LoadAndDelete and is otherwise the same as Delete.
+func (m *Map[K, V]) LoadAndDelete(key K) (value V, loaded bool) {
+	return m.Delete(key)
+}
+
+// Pop removes some entry from the map and returns it. ok is false if no entry
+// was found, which only happens when the map is empty or other goroutines emptied
+// it concurrently. Which entry is taken is unspecified. Successive calls start
+// looking at different shards, so concurrent callers draining the map as a work
+// queue spread over the shards instead of all contending on the first one, and
+// each entry is returned by exactly one Pop.
+func (m *Map[K, V]) Pop() (key K, value V, ok bool) {
+	m.checkWrite()
+	start := m.popNext.Add(1)
+	for {
+		tab := m.table()
+		var stale bool
+		for i := 0; i < tab.shards && !stale; i++ {
+			shard := int((start + uint64(i)) % uint64(tab.shards))
+			if tab.counts[shard].Load() == 0 {
+				continue
+			}
+			tab.mus[shard].Lock()
+			if m.tab.Load() != tab {
+				// replaced while waiting for the lock, start over on the new table
+				tab.mus[shard].Unlock()
+				stale = true
+				continue
+			}
+			key, value, ok = tab.maps[shard].GetPos(start)
+			if ok {
+				m.deleteLocked(tab, shard, key)
+			}
+			tab.mus[shard].Unlock()
+			if ok {
+				m.afterDelete(key, value)
+				return key, value, true
+			}
+		}
+		if !stale {
+			return key, value, false
+		}
+	}
+}
+
 // DeleteAccept deletes a value for a key. The "accept" function can be used to
 // inspect the previous value, if any, and accept or reject the change.
 // It's also provides a safe way to block other others from writing to the
 // same shard while inspecting.
 // Returns the deleted value, or false when no value was assigned.
 func (m *Map[K, V]) DeleteAccept(key K, accept func(prev V, replaced bool) bool) (prev V, deleted bool) {
-	m.initDo()
-	shard := m.choose(key)
-	m.mus[shard].Lock()
-	defer m.mus[shard].Unlock()
-	prev, deleted = m.maps[shard].Delete(key)
-	if accept != nil {
-		if !accept(prev, deleted) {
-			// revert unaccepted change
-			if deleted {
-				// reset updated data
-				m.maps[shard].Set(key, prev)
+	m.checkWrite()
+	func() {
+		tab, shard := m.lockKey(key)
+		defer tab.mus[shard].Unlock()
+		if accept != nil {
+			if !accept(tab.maps[shard].Get(key)) {
+				return
 			}
-			prev, deleted = m.zeroV, false
+		}
+		prev, deleted = m.deleteLocked(tab, shard, key)
+	}()
+	if deleted {
+		m.afterDelete(key, prev)
+	}
+	return prev, deleted
+}
+
+// Lock takes the write lock of the shard that key belongs to and returns a function
+// that releases it, which must be called exactly once. While held, no other
+// goroutine can read or write any key in that shard, which lets callers keep
+// external state consistent with the key's entry.
+//
+// This locks the whole shard, not just key. Calling a Map method that needs the
+// same shard, including for key itself, while holding the lock deadlocks, and so
+// can taking the shard locks of several keys in an inconsistent order.
+func (m *Map[K, V]) Lock(key K) (unlock func()) {
+	tab, shard := m.lockKey(key)
+	return tab.mus[shard].Unlock
+}
+
+// CoLocated reports whether a and b belong to the same shard of m, which is what
+// shard-scoped operations such as Lock or a single-shard Transact rely on. The
+// shard of a key depends on the map's random seed, so the result only holds for m
+// (and maps created from it with NewLike) and can differ between two maps or two
+// runs of a program, unless the placement is fixed with WithSeed, WithFixedSeed or
+// WithShardFunc.
+func (m *Map[K, V]) CoLocated(a, b K) bool {
+	tab := m.table()
+	return tab.choose(a) == tab.choose(b)
+}
+
+// ShardsFor returns the indexes of the shards keys belong to, sorted and without
+// duplicates. That is the order shard locks are taken in by multi-shard operations
+// such as Transact, and its length is the number of shards a batch over keys
+// touches. Like CoLocated, the result only holds for m.
+func (m *Map[K, V]) ShardsFor(keys []K) []int {
+	tab := m.table()
+	shards := make([]int, 0, len(keys))
+	for _, key := range keys {
+		shards = append(shards, tab.choose(key))
+	}
+	slices.Sort(shards)
+	return slices.Compact(shards)
+}
+
+// setLocked stores value for key in shard and updates the shard's bookkeeping.
+// The caller must hold the shard's write lock and must have interned key.
+func (m *Map[K, V]) setLocked(tab *table[K, V], shard int, key K, value V) (prev V, replaced bool) {
+	prev, replaced = tab.maps[shard].Set(key, value)
+	if grown := tab.grown[shard]; grown != nil {
+		grown.Delete(key)
+	}
+	if tab.bytes != nil {
+		size := m.sizeOf(key, value)
+		if replaced {
+			size -= m.sizeOf(key, prev)
+		}
+		tab.bytes[shard].Add(size)
+	}
+	m.publish(Change[K, V]{Key: key, Value: value})
+	m.storedLocked(tab, shard, key)
+	if tab.waits[shard].waiters > 0 {
+		tab.waits[shard].cond.Broadcast()
+	}
+	if !replaced {
+		tab.counts[shard].Add(1)
+		if neg := tab.negs[shard]; neg != nil {
+			neg.Delete(key)
+		}
+		if m.card != nil {
+			m.card.add(maphash.Comparable(m.card.seed, key))
 		}
 	}
+	return prev, replaced
+}
 
+// deleteLocked removes key from shard and updates the shard's bookkeeping.
+// The caller must hold the shard's write lock.
+func (m *Map[K, V]) deleteLocked(tab *table[K, V], shard int, key K) (prev V, deleted bool) {
+	prev, deleted = tab.maps[shard].Delete(key)
+	if deleted {
+		tab.counts[shard].Add(-1)
+		if grown := tab.grown[shard]; grown != nil {
+			grown.Delete(key)
+		}
+		if tab.bytes != nil {
+			tab.bytes[shard].Add(-m.sizeOf(key, prev))
+		}
+		m.publish(Change[K, V]{Key: key, Deleted: true})
+		m.forgetLocked(tab, shard, key)
+	}
 	return prev, deleted
 }
 
-// Len returns the number of values in map.
+// storedLocked updates the optional per-entry metadata for a store of key. The
+// caller must hold the shard's write lock.
+func (m *Map[K, V]) storedLocked(tab *table[K, V], shard int, key K) {
+	if tab.revs != nil {
+		m.setRevLocked(tab, shard, key)
+	}
+	if tab.stamps != nil {
+		tab.stamps[shard].Set(key, timeNow().UnixNano())
+	}
+	if tab.lrus != nil {
+		tab.lrus[shard].use(key)
+	}
+}
+
+// forgetLocked drops the optional per-entry metadata of a deleted key. The caller
+// must hold the shard's write lock.
+func (m *Map[K, V]) forgetLocked(tab *table[K, V], shard int, key K) {
+	if tab.revs != nil {
+		tab.revs[shard].revs.Delete(key)
+	}
+	if tab.stamps != nil {
+		tab.stamps[shard].Delete(key)
+	}
+	if tab.lrus != nil {
+		tab.lrus[shard].remove(key)
+	}
+}
+
+// resetMetaLocked empties the optional per-entry metadata of a shard, in place if
+// keep is set. Revision counters are not reset so revisions are never reused. The
+// caller must hold the shard's write lock.
+func (m *Map[K, V]) resetMetaLocked(tab *table[K, V], shard int, keep bool) {
+	if tab.revs != nil {
+		if keep && tab.revs[shard].revs != nil {
+			tab.revs[shard].revs.Clear()
+		} else {
+			tab.revs[shard].revs = rhh.New[K, uint64](0)
+		}
+	}
+	if tab.stamps != nil {
+		if keep && tab.stamps[shard] != nil {
+			tab.stamps[shard].Clear()
+		} else {
+			tab.stamps[shard] = rhh.New[K, int64](0)
+		}
+	}
+	if tab.lrus != nil {
+		tab.lrus[shard].reset()
+	}
+	if tab.bytes != nil {
+		tab.bytes[shard].Store(0)
+	}
+}
+
+// afterSet does the work for a stored key that must happen after the shard lock
+// has been released.
+func (m *Map[K, V]) afterSet(key K, value, prev V, replaced bool) {
+	m.notifySet(key, value, prev, replaced)
+	if m.overflows(replaced) {
+		m.trim(key)
+	}
+}
+
+// afterDelete does the work for a deleted key that must happen after the shard
+// lock has been released.
+func (m *Map[K, V]) afterDelete(key K, prev V) {
+	m.afterRemove(key, prev, EvictDeleted)
+}
+
+// afterRemove is afterDelete for a key removed for reason.
+func (m *Map[K, V]) afterRemove(key K, prev V, reason EvictReason) {
+	if m.interner != nil {
+		m.interner.release(key)
+	}
+	m.notifyRemove(key, prev, reason)
+}
+
+// Len returns the number of values in map. It does not take any locks, it sums
+// the per-shard counters that are maintained on insert and delete. Under concurrent
+// mutation the result is a point in time approximation across shards.
 func (m *Map[K, V]) Len() int {
-	m.initDo()
-	var len int
-	for i := 0; i < m.shards; i++ {
-		m.mus[i].Lock()
-		len += m.maps[i].Len()
-		m.mus[i].Unlock()
+	tab := m.table()
+	if tab.shards == 1 {
+		return int(tab.counts[0].Load())
+	}
+	var len int64
+	for i := 0; i < tab.shards; i++ {
+		len += tab.counts[i].Load()
 	}
-	return len
+	return int(len)
+}
+
+// Cap returns the capacity the map was created with by New, or last given to
+// Reset, and 0 for a zero Map. It is a sizing hint, not a limit or the current
+// size: the map holds any number of entries, Len reports how many it holds, and
+// the shards grow past their capacity as needed.
+func (m *Map[K, V]) Cap() int {
+	return int(m.cap.Load())
+}
+
+// CapPerShard returns the capacity each shard is created with, and reallocated
+// with by Clear: Cap divided by the shard count, or the room reserved with
+// WithShardCapacity if that is larger.
+func (m *Map[K, V]) CapPerShard() int {
+	return m.shardCap(m.table().shards)
+}
+
+// ShardSizes returns the number of values held by each shard, in shard order.
+// Like Len, it does not take any locks.
+func (m *Map[K, V]) ShardSizes() []int {
+	tab := m.table()
+	sizes := make([]int, tab.shards)
+	for i := range sizes {
+		sizes[i] = int(tab.counts[i].Load())
+	}
+	return sizes
+}
+
+// MaxProbeLength returns the longest probe sequence of any shard, see
+// ProbeLengths.
+func (m *Map[K, V]) MaxProbeLength() int {
+	return slices.Max(m.ProbeLengths())
+}
+
+// ProbeLengths returns, in shard order, the largest number of buckets a lookup in
+// each shard has to examine to find a key that is present (1 means every key is in
+// its home bucket, 0 means the shard is empty). Growing values warn of poor
+// hashing or high load before lookups visibly slow down. Each shard's buckets are
+// scanned under its read lock, so this is O(capacity) and meant for diagnostics.
+func (m *Map[K, V]) ProbeLengths() []int {
+	tab := m.table()
+	lengths := make([]int, tab.shards)
+	for i := range lengths {
+		tab.mus[i].RLock()
+		lengths[i] = tab.maps[i].MaxProbeLength()
+		tab.mus[i].RUnlock()
+	}
+	return lengths
 }
 
 // All returns a sequence of all key/values. It is not safe to call
 // Set, Delete or Range while iterating.
 func (m *Map[K, V]) All() iter.Seq2[K, V] {
-	m.initDo()
+	tab := m.table()
 	return func(yield func(K, V) bool) {
-		for i := 0; i < m.shards; i++ {
-			for k, v := range m.maps[i].All() {
+		for i := 0; i < tab.shards; i++ {
+			for k, v := range tab.maps[i].All() {
 				if !yield(k, v) {
 					return
 				}
@@ -154,23 +932,112 @@ func (m *Map[K, V]) All() iter.Seq2[K, V] {
 	}
 }
 
+// RangeWithShard calls fn for every key/value along with the index of the shard
+// that holds it. Iteration stops when fn returns false. Each shard's read lock is
+// held while its entries are passed to fn, so fn must not write to the map.
+func (m *Map[K, V]) RangeWithShard(fn func(shard int, key K, value V) bool) {
+	tab := m.table()
+	var done bool
+	for i := 0; i < tab.shards; i++ {
+		func() {
+			tab.mus[i].RLock()
+			defer tab.mus[i].RUnlock()
+			for k, v := range tab.maps[i].All() {
+				if !fn(i, k, v) {
+					done = true
+					return
+				}
+			}
+		}()
+		if done {
+			break
+		}
+	}
+}
+
+// Shards returns the number of shards, the valid indexes for RangeShard being 0 to
+// Shards()-1. It only changes when the shard layout is changed with Resize.
+func (m *Map[K, V]) Shards() int {
+	return m.table().shards
+}
+
+// RangeShard calls iter for every key/value of a single shard, under that shard's
+// read lock, until iter returns false. Only that shard is locked, and only for the
+// duration of the call, which lets a caller process the map one shard at a time
+// and do other work in between. iter must not write to the map.
+//
+// Calling RangeShard for every index visits every entry once, but as each shard is
+// visited at a different time, the result only matches a full Range if the map
+// was not modified in between. It panics if shard is not in [0, Shards()).
+func (m *Map[K, V]) RangeShard(shard int, iter func(key K, value V) bool) {
+	tab := m.table()
+	if shard < 0 || shard >= tab.shards {
+		panic(fmt.Sprintf("shardmap: shard %d out of range [0, %d)", shard, tab.shards))
+	}
+	tab.mus[shard].RLock()
+	defer tab.mus[shard].RUnlock()
+	for k, v := range tab.maps[shard].All() {
+		if !iter(k, v) {
+			return
+		}
+	}
+}
+
+// choose returns the shard of key in the current table.
 func (m *Map[K, V]) choose(key K) int {
-	return int(maphash.Comparable(m.seed, key) & uint64(m.shards-1))
+	return m.table().choose(key)
+}
+
+// shardCap returns the capacity each shard is created with in a table of shards
+// shards. It is in [0, maxShardCap].
+func (m *Map[K, V]) shardCap(shards int) int {
+	return min(max(int(m.cap.Load())/shards, m.minCap, 0), maxShardCap)
+}
+
+// shardCount returns the number of shards to use for cpus CPUs: the smallest power
+// of two that is at least cpus*16, bounded by maxShards. A cpus below 1 counts as
+// 1, so the default is never fewer than 16 shards.
+func shardCount(cpus int) int {
+	cpus = max(cpus, 1)
+	n := 1
+	// n/16 < cpus is n < cpus*16 without the overflow for huge cpus.
+	for n < maxShards && n/16 < cpus {
+		n *= 2
+	}
+	return n
+}
+
+// roundShards rounds a requested shard count of n > 0 up to a power of two,
+// bounded by maxShards.
+func roundShards(n int) int {
+	shards := 1
+	for shards < n && shards < maxShards {
+		shards *= 2
+	}
+	return shards
+}
+
+// fitShards returns the shard count to use for a requested count of n > 0: n
+// rounded up to a power of two, or only bounded with WithJumpHash, which places
+// keys over any number of shards.
+func (m *Map[K, V]) fitShards(n int) int {
+	if m.jump {
+		return min(n, maxShards)
+	}
+	return roundShards(n)
 }
 
 func (m *Map[K, V]) initDo() {
 	m.init.Do(func() {
-
-		m.shards = 1
-		for m.shards < runtime.NumCPU()*16 {
-			m.shards *= 2
+		shards := m.shards
+		if shards <= 0 {
+			shards = shardCount(numProcs())
 		}
-		scap := m.cap / m.shards
-		m.mus = make([]sync.RWMutex, m.shards)
-		m.maps = make([]*rhh.Map[K, V], m.shards)
-		for i := 0; i < len(m.maps); i++ {
-			m.maps[i] = rhh.New[K, V](scap)
+		shards = m.fitShards(shards)
+		seed := m.seed
+		if seed == (maphash.Seed{}) {
+			seed = maphash.MakeSeed()
 		}
-		m.seed = maphash.MakeSeed()
+		m.tab.Store(m.newTable(shards, seed))
 	})
 }
@@ -6,10 +6,18 @@ package shardmap
 
 import (
 	"fmt"
+	"hash/maphash"
+	"math"
 	"math/rand"
+	"runtime"
+	"slices"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	rhh "github.com/johnsiilver/shardmap/v2/hashmap"
 )
 
 type keyT = string
@@ -312,3 +320,1152 @@ func TestClear(t *testing.T) {
 	}
 
 }
+
+func TestNewCapacity(t *testing.T) {
+	for _, cap := range []int{0, -1, -5, 1} {
+		m := New[string, int](cap)
+		if m.Cap() < 0 {
+			t.Fatalf("New(%d): expected non-negative cap, got %v", cap, m.Cap())
+		}
+		for i := 0; i < 100; i++ {
+			m.Set(k(i), i)
+		}
+		if m.Len() != 100 {
+			t.Fatalf("New(%d): expected %v, got %v", cap, 100, m.Len())
+		}
+		for i := 0; i < 100; i++ {
+			v, ok := m.Get(k(i))
+			if !ok || v != i {
+				t.Fatalf("New(%d): expected %v, got %v", cap, i, v)
+			}
+		}
+		for i := 0; i < 100; i++ {
+			if _, ok := m.Delete(k(i)); !ok {
+				t.Fatalf("New(%d): expected true", cap)
+			}
+		}
+		m.Clear()
+		if m.Len() != 0 {
+			t.Fatalf("New(%d): expected %v, got %v", cap, 0, m.Len())
+		}
+		// Clear reallocates the shards with the same capacity
+		m.Set("a", 1)
+		if v, ok := m.Get("a"); !ok || v != 1 {
+			t.Fatalf("New(%d): after Clear: expected %v, got %v", cap, 1, v)
+		}
+	}
+}
+
+func TestWithShardFunc(t *testing.T) {
+	m := New[int, int](0, WithShardFunc[int, int](func(key, numShards int) int {
+		return key % numShards
+	}))
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	for i := 0; i < m.table().shards; i++ {
+		for key := range m.table().maps[i].All() {
+			if key%m.table().shards != i {
+				t.Fatalf("key %v: expected shard %v, got %v", key, key%m.table().shards, i)
+			}
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		if v, ok := m.Get(i); !ok || v != i {
+			t.Fatalf("expected %v, got %v", i, v)
+		}
+	}
+
+	bad := New[int, int](0, WithShardFunc[int, int](func(key, numShards int) int {
+		return numShards
+	}))
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic for out of range shard")
+		}
+	}()
+	bad.Set(1, 1)
+}
+
+func TestWithShards(t *testing.T) {
+	for n, want := range map[int]int{-1: shardCount(numProcs()), 0: shardCount(numProcs()), 1: 1, 3: 4, 64: 64, 100: 128, 1 << 30: maxShards} {
+		if got := New[int, int](0, WithShards[int, int](n)).table().shards; got != want {
+			t.Fatalf("WithShards(%d): expected %v, got %v", n, want, got)
+		}
+	}
+
+	m := New[string, int](0, WithShards[string, int](5))
+	used := map[int]bool{}
+	for i := 0; i < 1000; i++ {
+		m.Set(k(i), i)
+		shard := m.choose(k(i))
+		if shard < 0 || shard >= 8 {
+			t.Fatalf("key %v: shard %v out of range", k(i), shard)
+		}
+		used[shard] = true
+	}
+	if len(used) != 8 {
+		t.Fatalf("expected %v shards used, got %v", 8, len(used))
+	}
+	if len(m.ShardSizes()) != 8 || m.Len() != 1000 {
+		t.Fatalf("expected %v shards with %v entries, got %v with %v", 8, 1000, len(m.ShardSizes()), m.Len())
+	}
+}
+
+func TestCap(t *testing.T) {
+	var zero Map[int, int]
+	if zero.Cap() != 0 || zero.CapPerShard() != 0 {
+		t.Fatalf("expected %v/%v, got %v/%v", 0, 0, zero.Cap(), zero.CapPerShard())
+	}
+	m := New[int, int](1000, WithShards[int, int](4))
+	for i := 0; i < 5000; i++ {
+		m.Set(i, i)
+	}
+	// the capacity is what New was given, not the size
+	if m.Cap() != 1000 || m.CapPerShard() != 250 {
+		t.Fatalf("expected %v/%v, got %v/%v", 1000, 250, m.Cap(), m.CapPerShard())
+	}
+	if New[int, int](-5).Cap() != 0 {
+		t.Fatalf("expected %v, got %v", 0, New[int, int](-5).Cap())
+	}
+	reserved := New[int, int](1000, WithShards[int, int](4), WithShardCapacity[int, int](512))
+	if reserved.CapPerShard() != 512 {
+		t.Fatalf("expected %v, got %v", 512, reserved.CapPerShard())
+	}
+}
+
+func TestWithShardCapacity(t *testing.T) {
+	fill := func(m *Map[int, int]) uint64 {
+		defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+		m.Len() // initialize the shards before measuring
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		for i := 0; i < 1000; i++ {
+			m.Set(i, i)
+		}
+		runtime.ReadMemStats(&after)
+		return after.Mallocs - before.Mallocs
+	}
+	if n := fill(New[int, int](0, WithShards[int, int](16))); n == 0 {
+		t.Fatal("expected shards without reserved room to grow")
+	}
+	m := New[int, int](0, WithShards[int, int](16), WithShardCapacity[int, int](1024))
+	if n := fill(m); n != 0 {
+		t.Fatalf("expected no growth, got %v allocs", n)
+	}
+	if m.shardCap(16) != 1024 || m.NewLike().minCap != 1024 {
+		t.Fatal("expected the capacity to be kept")
+	}
+	// the capacity from New still applies when it is larger
+	if got := New[int, int](1<<20, WithShardCapacity[int, int](1)).shardCap(16); got != 1<<16 {
+		t.Fatalf("expected %v, got %v", 1<<16, got)
+	}
+}
+
+func TestLenCounters(t *testing.T) {
+	var m Map[string, int]
+	const workers, n = 8, 2000
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if l := m.Len(); l < 0 || l > workers*n {
+				t.Errorf("Len out of range: %v", l)
+				return
+			}
+		}
+	}()
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				key := fmt.Sprintf("%d-%d", w, i)
+				m.Set(key, i)
+				m.Set(key, i+1)
+				if i%2 == 0 {
+					m.Delete(key)
+					m.Delete(key)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(done)
+
+	if m.Len() != workers*n/2 {
+		t.Fatalf("expected %v, got %v", workers*n/2, m.Len())
+	}
+	sizes := m.ShardSizes()
+	for i, size := range sizes {
+		if size != m.table().maps[i].Len() {
+			t.Fatalf("shard %d: expected %v, got %v", i, m.table().maps[i].Len(), size)
+		}
+	}
+
+	// Reverted accept calls must leave the counters untouched.
+	m.SetAccept("new", 1, func(int, bool) bool { return false })
+	m.DeleteAccept(fmt.Sprintf("%d-%d", 0, 1), func(int, bool) bool { return false })
+	if m.Len() != workers*n/2 {
+		t.Fatalf("expected %v, got %v", workers*n/2, m.Len())
+	}
+	m.Clear()
+	if m.Len() != 0 {
+		t.Fatalf("expected %v, got %v", 0, m.Len())
+	}
+}
+
+func TestShardBounds(t *testing.T) {
+	for cpus, want := range map[int]int{-1: 16, 0: 16, 1: 16, 3: 64, 4: 64, 1 << 20: maxShards, math.MaxInt: maxShards} {
+		if got := shardCount(cpus); got != want {
+			t.Fatalf("shardCount(%d): expected %v, got %v", cpus, want, got)
+		}
+	}
+
+	m := New[int, int](math.MaxInt)
+	if got := m.shardCap(16); got != maxShardCap {
+		t.Fatalf("expected %v, got %v", maxShardCap, got)
+	}
+
+	numProcs = func() int { return math.MaxInt }
+	defer func() { numProcs = gomaxprocs }()
+	m = New[int, int](maxShards * 2)
+	m.Set(1, 1)
+	if m.table().shards != maxShards {
+		t.Fatalf("expected %v, got %v", maxShards, m.table().shards)
+	}
+	if v, ok := m.Get(1); !ok || v != 1 {
+		t.Fatalf("expected %v, got %v", 1, v)
+	}
+}
+
+func TestLowGOMAXPROCS(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+	var m Map[int, int]
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	if m.table().shards != 16 {
+		t.Fatalf("expected %v, got %v", 16, m.table().shards)
+	}
+	for i := 0; i < 1000; i++ {
+		if v, ok := m.Get(i); !ok || v != i {
+			t.Fatalf("key %v: expected %v, got %v", i, i, v)
+		}
+	}
+
+	// the shard count follows GOMAXPROCS rather than the number of CPUs
+	runtime.GOMAXPROCS(4)
+	if n := new(Map[int, int]).table().shards; n != 64 {
+		t.Fatalf("expected %v, got %v", 64, n)
+	}
+}
+
+func TestCoLocated(t *testing.T) {
+	var m Map[string, int]
+	if !m.CoLocated("a", "a") {
+		t.Fatal("expected a key to be co-located with itself")
+	}
+	var apart int
+	for i := 1; i < 1000; i++ {
+		got := m.CoLocated(k(0), k(i))
+		if want := m.choose(k(0)) == m.choose(k(i)); got != want {
+			t.Fatalf("key %v: expected %v, got %v", k(i), want, got)
+		}
+		if !got {
+			apart++
+		}
+	}
+	if apart == 0 {
+		t.Fatal("expected some keys on other shards")
+	}
+
+	n := New[int, int](0, WithShardFunc[int, int](func(key, numShards int) int {
+		return key % 2
+	}))
+	if !n.CoLocated(2, 4) || n.CoLocated(2, 3) {
+		t.Fatal("expected CoLocated to follow the shard func")
+	}
+}
+
+func TestSingleShard(t *testing.T) {
+	m := &Map[string, int]{shards: 1}
+	for i := 0; i < 100; i++ {
+		m.Set(k(i), i)
+	}
+	if len(m.table().maps) != 1 {
+		t.Fatalf("expected %v, got %v", 1, len(m.table().maps))
+	}
+	if m.Len() != 100 {
+		t.Fatalf("expected %v, got %v", 100, m.Len())
+	}
+	for i := 0; i < 100; i++ {
+		if m.choose(k(i)) != 0 {
+			t.Fatalf("expected %v, got %v", 0, m.choose(k(i)))
+		}
+		if v, _ := m.Get(k(i)); v != i {
+			t.Fatalf("expected %v, got %v", i, v)
+		}
+	}
+	var n int
+	for range m.All() {
+		n++
+	}
+	if n != 100 {
+		t.Fatalf("expected %v, got %v", 100, n)
+	}
+}
+
+func TestShardsFor(t *testing.T) {
+	m := New[int, int](0, WithShardFunc[int, int](func(key, numShards int) int {
+		return key % numShards
+	}))
+	got := m.ShardsFor([]int{5, 3, 3, 21, 1, 5})
+	want := []int{1, 3, 5}
+	if !slices.Equal(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	if got := m.ShardsFor(nil); len(got) != 0 {
+		t.Fatalf("expected %v, got %v", []int{}, got)
+	}
+}
+
+func TestLock(t *testing.T) {
+	var m Map[string, int]
+	m.Set("a", 1)
+	unlock := m.Lock("a")
+
+	done := make(chan struct{})
+	go func() {
+		m.Set("a", 2)
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("Set must block while the shard is locked")
+	case <-time.After(10 * time.Millisecond):
+	}
+	unlock()
+	<-done
+	if v, _ := m.Get("a"); v != 2 {
+		t.Fatalf("expected %v, got %v", 2, v)
+	}
+}
+
+func TestReset(t *testing.T) {
+	m := New[int, int](0, WithShards[int, int](4))
+	for i := 0; i < 10000; i++ {
+		m.Set(i, i)
+	}
+	m.Reset(100000)
+	if m.Len() != 0 {
+		t.Fatalf("expected %v, got %v", 0, m.Len())
+	}
+	if _, ok := m.Get(1); ok {
+		t.Fatal("expected false")
+	}
+	if m.Cap() != 100000 {
+		t.Fatalf("expected %v, got %v", 100000, m.Cap())
+	}
+	// the shards are presized, so filling them to the new capacity does not grow them
+	slots := m.MemStats().Slots
+	for i := 0; i < 100000; i++ {
+		m.Set(i, i)
+	}
+	if got := m.MemStats().Slots; got != slots {
+		t.Fatalf("expected %v slots, got %v", slots, got)
+	}
+
+	// Clear keeps the capacity given to Reset
+	m.Clear()
+	if got := m.MemStats().Slots; got != slots {
+		t.Fatalf("expected %v slots, got %v", slots, got)
+	}
+
+	m.Reset(-5)
+	if m.Cap() != 0 {
+		t.Fatalf("expected %v, got %v", 0, m.Cap())
+	}
+	if got := m.MemStats().Slots; got >= slots {
+		t.Fatalf("expected the shards to shrink from %v slots, got %v", slots, got)
+	}
+	m.Set(1, 1)
+	if v, _ := m.Get(1); v != 1 {
+		t.Fatalf("expected %v, got %v", 1, v)
+	}
+
+	var z Map[int, int]
+	z.Reset(10)
+	if z.Cap() != 10 || z.Len() != 0 {
+		t.Fatalf("expected cap %v and len %v, got %v and %v", 10, 0, z.Cap(), z.Len())
+	}
+}
+
+func TestResetKeep(t *testing.T) {
+	var m Map[int, int]
+	for i := 0; i < 10000; i++ {
+		m.Set(i, i)
+	}
+	shards := make([]*rhh.Map[int, int], m.table().shards)
+	copy(shards, m.table().maps)
+
+	m.ResetKeep()
+	if m.Len() != 0 {
+		t.Fatalf("expected %v, got %v", 0, m.Len())
+	}
+	for i := range shards {
+		if m.table().maps[i] != shards[i] {
+			t.Fatalf("shard %d was reallocated", i)
+		}
+		if m.table().maps[i].Len() != 0 {
+			t.Fatalf("shard %d: expected %v, got %v", i, 0, m.table().maps[i].Len())
+		}
+	}
+	if _, ok := m.Get(1); ok {
+		t.Fatal("expected false")
+	}
+
+	allocs := testing.AllocsPerRun(1, func() {
+		for i := 0; i < 10000; i++ {
+			m.Set(i, i)
+		}
+		m.ResetKeep()
+	})
+	if allocs != 0 {
+		t.Fatalf("expected refill to not allocate, got %v allocs", allocs)
+	}
+}
+
+func TestProbeLengths(t *testing.T) {
+	var m Map[int, int]
+	if m.MaxProbeLength() != 0 {
+		t.Fatalf("expected %v, got %v", 0, m.MaxProbeLength())
+	}
+	for i := 0; i < 10000; i++ {
+		m.Set(i, i)
+	}
+	lengths := m.ProbeLengths()
+	if len(lengths) != m.table().shards {
+		t.Fatalf("expected %v, got %v", m.table().shards, len(lengths))
+	}
+	var want int
+	for i, l := range lengths {
+		if m.table().maps[i].Len() > 0 && l < 1 {
+			t.Fatalf("shard %d: expected a probe length for a non-empty shard", i)
+		}
+		want = max(want, l)
+	}
+	if m.MaxProbeLength() != want {
+		t.Fatalf("expected %v, got %v", want, m.MaxProbeLength())
+	}
+}
+
+func TestReplace(t *testing.T) {
+	var m Map[string, int]
+	if old, ok := m.Replace("a", 1); ok || old != 0 {
+		t.Fatalf("expected %v, got %v", 0, old)
+	}
+	if _, ok := m.Get("a"); ok || m.Len() != 0 {
+		t.Fatal("Replace must not create a key")
+	}
+	m.Set("a", 1)
+	if old, ok := m.Replace("a", 2); !ok || old != 1 {
+		t.Fatalf("expected %v, got %v", 1, old)
+	}
+	if v, _ := m.Get("a"); v != 2 {
+		t.Fatalf("expected %v, got %v", 2, v)
+	}
+	if m.Len() != 1 {
+		t.Fatalf("expected %v, got %v", 1, m.Len())
+	}
+}
+
+func TestSetIfPresent(t *testing.T) {
+	var m Map[string, int]
+	if prev, replaced := m.SetIfPresent("a", 1); replaced || prev != 0 {
+		t.Fatalf("expected %v/%v, got %v/%v", 0, false, prev, replaced)
+	}
+	if m.Contains("a") || m.Len() != 0 {
+		t.Fatal("SetIfPresent must not create a key")
+	}
+	m.Set("a", 1)
+	if prev, replaced := m.SetIfPresent("a", 2); !replaced || prev != 1 {
+		t.Fatalf("expected %v/%v, got %v/%v", 1, true, prev, replaced)
+	}
+	if v, _ := m.Get("a"); v != 2 || m.Len() != 1 {
+		t.Fatalf("expected %v with Len %v, got %v with Len %v", 2, 1, v, m.Len())
+	}
+}
+
+func TestGetAndRefresh(t *testing.T) {
+	var m Map[string, int]
+	var calls int
+	bump := func(old int) int { calls++; return old + 1 }
+	if v, ok := m.GetAndRefresh("a", bump); ok || v != 0 {
+		t.Fatalf("expected %v/%v, got %v/%v", 0, false, v, ok)
+	}
+	if calls != 0 {
+		t.Fatalf("fn must not be called for an absent key, got %v calls", calls)
+	}
+	if m.Contains("a") || m.Len() != 0 {
+		t.Fatal("GetAndRefresh must not create a key")
+	}
+
+	m.Set("a", 1)
+	if v, ok := m.GetAndRefresh("a", bump); !ok || v != 2 {
+		t.Fatalf("expected %v/%v, got %v/%v", 2, true, v, ok)
+	}
+	if v, _ := m.Get("a"); v != 2 || m.Len() != 1 || calls != 1 {
+		t.Fatalf("expected %v with Len %v after %v call, got %v with Len %v after %v", 2, 1, 1, v, m.Len(), calls)
+	}
+
+	// the read and the write are not interleaved with other writers
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				m.GetAndRefresh("a", func(old int) int { return old + 1 })
+			}
+		}()
+	}
+	wg.Wait()
+	if v, _ := m.Get("a"); v != 8002 {
+		t.Fatalf("expected %v, got %v", 8002, v)
+	}
+}
+
+func TestGetOrSet(t *testing.T) {
+	var m Map[string, int]
+	if actual, loaded := m.GetOrSet("a", 1); loaded || actual != 1 {
+		t.Fatalf("expected %v/%v, got %v/%v", 1, false, actual, loaded)
+	}
+	if actual, loaded := m.GetOrSet("a", 2); !loaded || actual != 1 {
+		t.Fatalf("expected %v/%v, got %v/%v", 1, true, actual, loaded)
+	}
+	if v, _ := m.Get("a"); v != 1 {
+		t.Fatalf("expected %v, got %v", 1, v)
+	}
+	if m.Len() != 1 {
+		t.Fatalf("expected %v, got %v", 1, m.Len())
+	}
+
+	// only one of many concurrent callers stores its value
+	var wg sync.WaitGroup
+	var stored atomic.Int64
+	winners := make([]int, 8)
+	for i := range winners {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			actual, loaded := m.GetOrSet("b", i)
+			if !loaded {
+				stored.Add(1)
+			}
+			winners[i] = actual
+		}(i)
+	}
+	wg.Wait()
+	if stored.Load() != 1 {
+		t.Fatalf("expected %v, got %v", 1, stored.Load())
+	}
+	for _, w := range winners {
+		if w != winners[0] {
+			t.Fatalf("expected %v, got %v", winners[0], w)
+		}
+	}
+}
+
+func TestGetOrCompute(t *testing.T) {
+	var m Map[string, int]
+	var calls int
+	fn := func() int {
+		calls++
+		return 1
+	}
+	if actual, loaded := m.GetOrCompute("a", fn); loaded || actual != 1 {
+		t.Fatalf("expected %v/%v, got %v/%v", 1, false, actual, loaded)
+	}
+	if calls != 1 {
+		t.Fatalf("expected %v, got %v", 1, calls)
+	}
+	m.Set("a", 2)
+	for i := 0; i < 10; i++ {
+		if actual, loaded := m.GetOrCompute("a", fn); !loaded || actual != 2 {
+			t.Fatalf("expected %v/%v, got %v/%v", 2, true, actual, loaded)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("expected fn to not be called on a hit, got %v calls", calls)
+	}
+
+	// fn runs once for many concurrent callers of an absent key
+	var computed atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.GetOrCompute("b", func() int { return int(computed.Add(1)) })
+		}()
+	}
+	wg.Wait()
+	if computed.Load() != 1 {
+		t.Fatalf("expected %v, got %v", 1, computed.Load())
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	var m Map[string, int]
+	incr := func(old int, ok bool) (int, bool) { return old + 1, true }
+	if v, stored := m.Update("a", incr); !stored || v != 1 {
+		t.Fatalf("expected %v/%v, got %v/%v", 1, true, v, stored)
+	}
+	if v, stored := m.Update("a", incr); !stored || v != 2 {
+		t.Fatalf("expected %v/%v, got %v/%v", 2, true, v, stored)
+	}
+	// not storing leaves present and absent keys alone
+	skip := func(old int, ok bool) (int, bool) { return -1, false }
+	if v, stored := m.Update("a", skip); stored || v != 2 {
+		t.Fatalf("expected %v/%v, got %v/%v", 2, false, v, stored)
+	}
+	if v, stored := m.Update("b", skip); stored || v != 0 {
+		t.Fatalf("expected %v/%v, got %v/%v", 0, false, v, stored)
+	}
+	if _, ok := m.Get("b"); ok || m.Len() != 1 {
+		t.Fatal("expected b to not be stored")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				m.Update("c", incr)
+			}
+		}()
+	}
+	wg.Wait()
+	if v, _ := m.Get("c"); v != 8000 {
+		t.Fatalf("expected %v, got %v", 8000, v)
+	}
+}
+
+func TestSetIfAbsent(t *testing.T) {
+	var m Map[string, int]
+	if !m.SetIfAbsent("a", 1) {
+		t.Fatal("expected the first SetIfAbsent to store")
+	}
+	if m.SetIfAbsent("a", 2) {
+		t.Fatal("expected the second SetIfAbsent to not store")
+	}
+	if v, _ := m.Get("a"); v != 1 {
+		t.Fatalf("expected %v, got %v", 1, v)
+	}
+	if m.Len() != 1 {
+		t.Fatalf("expected %v, got %v", 1, m.Len())
+	}
+}
+
+func TestSwap(t *testing.T) {
+	var m Map[string, int]
+	if prev, loaded := m.Swap("a", 0); loaded || prev != 0 {
+		t.Fatalf("expected %v/%v, got %v/%v", 0, false, prev, loaded)
+	}
+	// the stored zero value is still reported as loaded
+	if prev, loaded := m.Swap("a", 1); !loaded || prev != 0 {
+		t.Fatalf("expected %v/%v, got %v/%v", 0, true, prev, loaded)
+	}
+	if prev, loaded := m.Swap("a", 2); !loaded || prev != 1 {
+		t.Fatalf("expected %v/%v, got %v/%v", 1, true, prev, loaded)
+	}
+	if v, _ := m.Get("a"); v != 2 {
+		t.Fatalf("expected %v, got %v", 2, v)
+	}
+}
+
+func TestLoadAndDelete(t *testing.T) {
+	var m Map[string, int]
+	if v, loaded := m.LoadAndDelete("a"); loaded || v != 0 {
+		t.Fatalf("expected %v/%v, got %v/%v", 0, false, v, loaded)
+	}
+	for round := 0; round < 100; round++ {
+		m.Set("a", round)
+		var wg sync.WaitGroup
+		var winners atomic.Int32
+		for w := 0; w < 8; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if v, loaded := m.LoadAndDelete("a"); loaded {
+					winners.Add(1)
+					if v != round {
+						t.Errorf("expected %v, got %v", round, v)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		if winners.Load() != 1 {
+			t.Fatalf("round %d: expected %v goroutine to load the key, got %v", round, 1, winners.Load())
+		}
+		if m.Len() != 0 {
+			t.Fatalf("round %d: expected %v, got %v", round, 0, m.Len())
+		}
+	}
+}
+
+func TestPop(t *testing.T) {
+	var m Map[string, int]
+	if _, _, ok := m.Pop(); ok {
+		t.Fatal("expected an empty map to return false")
+	}
+	m.Set("a", 1)
+	if key, value, ok := m.Pop(); !ok || key != "a" || value != 1 {
+		t.Fatalf("expected a/1/true, got %v/%v/%v", key, value, ok)
+	}
+	if m.Len() != 0 {
+		t.Fatalf("expected %v, got %v", 0, m.Len())
+	}
+}
+
+func TestPopConcurrent(t *testing.T) {
+	var m Map[int, int]
+	const n = 10000
+	for i := 0; i < n; i++ {
+		m.Set(i, i)
+	}
+	var mu sync.Mutex
+	popped := map[int]int{}
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				key, value, ok := m.Pop()
+				if !ok {
+					return
+				}
+				if key != value {
+					t.Errorf("key %v: expected %v, got %v", key, key, value)
+				}
+				mu.Lock()
+				popped[key]++
+				mu.Unlock()
+			}
+		}()
+	}
+	// a layout change while draining must not lose or duplicate entries
+	m.Resize(4)
+	wg.Wait()
+	if len(popped) != n || m.Len() != 0 {
+		t.Fatalf("expected %v entries popped and none left, got %v and %v", n, len(popped), m.Len())
+	}
+	for key, times := range popped {
+		if times != 1 {
+			t.Fatalf("key %v popped %v times", key, times)
+		}
+	}
+}
+
+func TestContains(t *testing.T) {
+	var m Map[string, int]
+	if m.Contains("a") {
+		t.Fatal("expected false")
+	}
+	m.Set("a", 0)
+	if !m.Contains("a") {
+		t.Fatal("expected true")
+	}
+	m.Delete("a")
+	if m.Contains("a") {
+		t.Fatal("expected false after delete")
+	}
+}
+
+func TestClone(t *testing.T) {
+	m := New[string, []int](100)
+	for i := 0; i < 1000; i++ {
+		m.Set(k(i), []int{i})
+	}
+	c := m.Clone()
+	if c.Len() != m.Len() {
+		t.Fatalf("expected %v, got %v", m.Len(), c.Len())
+	}
+	if c.Cap() != m.Cap() || !c.table().aligned(m.table()) {
+		t.Fatal("expected the clone to have the same configuration")
+	}
+	for i := 0; i < 1000; i++ {
+		if c.choose(k(i)) != m.choose(k(i)) {
+			t.Fatalf("key %v: expected shard %v, got %v", k(i), m.choose(k(i)), c.choose(k(i)))
+		}
+		if v, ok := c.Get(k(i)); !ok || v[0] != i {
+			t.Fatalf("key %v: expected %v, got %v", k(i), i, v)
+		}
+	}
+	c.Set("new", nil)
+	c.Delete(k(0))
+	m.Delete(k(1))
+	if _, ok := m.Get("new"); ok || !m.Contains(k(0)) || !c.Contains(k(1)) {
+		t.Fatal("expected the maps to be independent")
+	}
+	// values are copied by assignment
+	v, _ := m.Get(k(2))
+	v[0] = -1
+	if v, _ := c.Get(k(2)); v[0] != -1 {
+		t.Fatalf("expected %v, got %v", -1, v[0])
+	}
+}
+
+func TestFilter(t *testing.T) {
+	m := New[string, int](0, WithShards[string, int](4))
+	for i := 0; i < 1000; i++ {
+		m.Set(k(i), i)
+	}
+	if f := m.Filter(func(string, int) bool { return false }); f.Len() != 0 {
+		t.Fatalf("expected %v, got %v", 0, f.Len())
+	}
+	all := m.Filter(func(string, int) bool { return true })
+	if !EqualComparable(all, m) {
+		t.Fatal("expected an always true filter to clone the map")
+	}
+	if !all.table().aligned(m.table()) {
+		t.Fatal("expected the result to have the same shard layout")
+	}
+
+	even := m.Filter(func(key string, value int) bool { return value%2 == 0 })
+	if even.Len() != 500 {
+		t.Fatalf("expected %v, got %v", 500, even.Len())
+	}
+	for i := 0; i < 1000; i++ {
+		if v, ok := even.Get(k(i)); ok != (i%2 == 0) || (ok && v != i) {
+			t.Fatalf("key %v: expected %v/%v, got %v/%v", k(i), i, i%2 == 0, v, ok)
+		}
+	}
+	// the result is independent of m
+	even.Set("new", 1)
+	if m.Contains("new") {
+		t.Fatal("expected the maps to be independent")
+	}
+}
+
+func TestShrink(t *testing.T) {
+	m := New[int, int](0, WithShards[int, int](4))
+	for i := 0; i < 40000; i++ {
+		m.Set(i, i)
+	}
+	// 30% full, which a shard does not shrink at on its own
+	for i := 12000; i < 40000; i++ {
+		m.Delete(i)
+	}
+	caps := func() (n int) {
+		for _, shard := range m.table().maps {
+			n += shard.Cap()
+		}
+		return n
+	}
+	before := caps()
+	m.Shrink()
+	if after := caps(); after > before/4 {
+		t.Fatalf("expected the capacity to shrink from %v, got %v", before, after)
+	}
+	if m.Len() != 12000 {
+		t.Fatalf("expected %v, got %v", 12000, m.Len())
+	}
+	for i := 0; i < 12000; i++ {
+		if v, ok := m.Get(i); !ok || v != i {
+			t.Fatalf("expected %v, got %v", i, v)
+		}
+	}
+}
+
+func TestGrow(t *testing.T) {
+	m := New[int, int](0, WithShards[int, int](4))
+	for i := 0; i < 10000; i++ {
+		m.Set(i, i)
+	}
+	before := m.MemStats().Slots
+	m.Grow(0)
+	m.Grow(-1)
+	if got := m.MemStats().Slots; got != before {
+		t.Fatalf("expected %v slots, got %v", before, got)
+	}
+	m.Grow(40000)
+	grown := m.MemStats().Slots
+	if grown <= before {
+		t.Fatalf("expected more than %v slots, got %v", before, grown)
+	}
+	if m.Len() != 10000 {
+		t.Fatalf("expected %v, got %v", 10000, m.Len())
+	}
+	for i := 0; i < 10000; i++ {
+		if v, ok := m.Get(i); !ok || v != i {
+			t.Fatalf("expected %v, got %v", i, v)
+		}
+	}
+	// a map with room is left alone
+	m.Grow(1000)
+	if got := m.MemStats().Slots; got != grown {
+		t.Fatalf("expected %v slots, got %v", grown, got)
+	}
+	for i := 10000; i < 50000; i++ {
+		m.Set(i, i)
+	}
+	if got := m.MemStats().Slots; got != grown {
+		t.Fatalf("expected the %v entries to fit in %v slots, got %v", 50000, grown, got)
+	}
+}
+
+func TestSetReadOnly(t *testing.T) {
+	var m Map[string, int]
+	m.Set("a", 1)
+	m.SetReadOnly(true)
+
+	writes := map[string]func(){
+		"Set":              func() { m.Set("b", 1) },
+		"SetAccept":        func() { m.SetAccept("b", 1, nil) },
+		"Replace":          func() { m.Replace("a", 2) },
+		"SetIfPresent":     func() { m.SetIfPresent("a", 2) },
+		"GetAndRefresh":    func() { m.GetAndRefresh("a", func(v int) int { return v }) },
+		"Do":               func() { m.Do("a", func(func() (int, bool), func(int), func()) {}) },
+		"SetIf":            func() { m.SetIf("a", 2, func(int, bool) bool { return true }) },
+		"GetOrSet":         func() { m.GetOrSet("b", 1) },
+		"SetIfAbsent":      func() { m.SetIfAbsent("b", 1) },
+		"GetOrCompute":     func() { m.GetOrCompute("b", func() int { return 1 }) },
+		"Swap":             func() { m.Swap("a", 2) },
+		"Add":              func() { Add(&m, "a", 1) },
+		"Transfer":         func() { Transfer(&m, New[string, int](0), "a") },
+		"CompareAndSwap":   func() { CompareAndSwap(&m, "a", 1, 2) },
+		"CompareAndDelete": func() { CompareAndDelete(&m, "a", 1) },
+		"Update":           func() { m.Update("a", func(v int, _ bool) (int, bool) { return v + 1, true }) },
+		"SetNotify":        func() { m.SetNotify("a", 2, func(int, bool) {}) },
+		"SetMany":          func() { m.SetMany(map[string]int{"b": 1}) },
+		"DeleteMany":       func() { m.DeleteMany([]string{"a"}) },
+		"PopMany":          func() { m.PopMany([]string{"a"}) },
+		"TransformValues":  func() { m.TransformValues(func(_ string, v int) int { return v }) },
+		"SetAcceptRev":     func() { m.SetAcceptRev("a", 2, func(int, uint64, bool) bool { return true }) },
+		"PurgeOlderThan":   func() { m.PurgeOlderThan(time.Now()) },
+		"RemoveAllFrom":    func() { m.RemoveAllFrom(&m) },
+		"Delete":           func() { m.Delete("a") },
+		"LoadAndDelete":    func() { m.LoadAndDelete("a") },
+		"Pop":              func() { m.Pop() },
+		"DeleteAccept":     func() { m.DeleteAccept("a", nil) },
+		"Clear":            func() { m.Clear() },
+		"Reset":            func() { m.Reset(10) },
+		"ResetKeep":        func() { m.ResetKeep() },
+		"SetNegative":      func() { m.SetNegative("a", time.Minute) },
+		"LoadParallel":     func() { m.LoadParallel(New[string, int](0), 1) },
+		"Rebuild":          func() { m.Rebuild(maphash.MakeSeed(), nil) },
+		"Shrink":           func() { m.Shrink() },
+		"Grow":             func() { m.Grow(10) },
+		"Resize":           func() { m.Resize(4) },
+		"Merge":            func() { m.Merge(New[string, int](0), nil) },
+		"ApplyDelta":       func() { m.ApplyDelta(New[string, int](0), nil) },
+		"Transact": func() {
+			m.Transact([]string{"a"}, func(txn Txn[string, int]) error {
+				txn.Set("a", 2)
+				return nil
+			})
+		},
+	}
+	for name, write := range writes {
+		func() {
+			defer func() {
+				if r := recover(); r != ErrReadOnly {
+					t.Fatalf("%s: expected panic %v, got %v", name, ErrReadOnly, r)
+				}
+			}()
+			write()
+		}()
+	}
+	if v, ok := m.Get("a"); !ok || v != 1 || m.Len() != 1 {
+		t.Fatalf("expected map to be unchanged, got %v", v)
+	}
+	// read-only transactions are allowed
+	err := m.Transact([]string{"a"}, func(txn Txn[string, int]) error {
+		txn.Get("a")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.SetReadOnly(false)
+	m.Set("b", 2)
+	if m.Len() != 2 {
+		t.Fatalf("expected %v, got %v", 2, m.Len())
+	}
+}
+
+func TestSetIf(t *testing.T) {
+	var m Map[string, int]
+	absent := func(old int, exists bool) bool { return !exists }
+	greater := func(v int) func(int, bool) bool {
+		return func(old int, exists bool) bool { return !exists || v > old }
+	}
+
+	if old, set := m.SetIf("a", 1, absent); !set || old != 0 {
+		t.Fatalf("expected set, got %v, %v", old, set)
+	}
+	if old, set := m.SetIf("a", 2, absent); set || old != 1 {
+		t.Fatalf("expected not set, got %v, %v", old, set)
+	}
+	if old, set := m.SetIf("a", 5, greater(5)); !set || old != 1 {
+		t.Fatalf("expected set, got %v, %v", old, set)
+	}
+	if old, set := m.SetIf("a", 3, greater(3)); set || old != 5 {
+		t.Fatalf("expected not set, got %v, %v", old, set)
+	}
+	if old, set := m.SetIf("b", 1, func(old int, exists bool) bool { return exists }); set || old != 0 {
+		t.Fatalf("expected not set, got %v, %v", old, set)
+	}
+	if v, _ := m.Get("a"); v != 5 {
+		t.Fatalf("expected %v, got %v", 5, v)
+	}
+	if m.Len() != 1 {
+		t.Fatalf("expected %v, got %v", 1, m.Len())
+	}
+}
+
+func TestSetNotify(t *testing.T) {
+	var m Map[string, int]
+	var calls []int
+	notify := func(old int, existed bool) {
+		if !existed {
+			old = -1
+		}
+		calls = append(calls, old)
+	}
+	if prev, existed := m.SetNotify("a", 1, notify); existed || prev != 0 {
+		t.Fatalf("expected %v, got %v", 0, prev)
+	}
+	if prev, existed := m.SetNotify("a", 2, notify); !existed || prev != 1 {
+		t.Fatalf("expected %v, got %v", 1, prev)
+	}
+	if len(calls) != 2 || calls[0] != -1 || calls[1] != 1 {
+		t.Fatalf("expected %v, got %v", []int{-1, 1}, calls)
+	}
+	if v, _ := m.Get("a"); v != 2 {
+		t.Fatalf("expected %v, got %v", 2, v)
+	}
+}
+
+func TestLenDoesNotBlockReaders(t *testing.T) {
+	var m Map[string, int]
+	for i := 0; i < 100; i++ {
+		m.Set(k(i), i)
+	}
+	// Hold every shard's read lock like in-flight Gets would. A Len that takes
+	// write locks would block until they are released.
+	for i := range m.table().mus {
+		m.table().mus[i].RLock()
+	}
+	done := make(chan int)
+	go func() {
+		done <- m.Len()
+	}()
+	select {
+	case n := <-done:
+		if n != 100 {
+			t.Fatalf("expected %v, got %v", 100, n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Len blocked on readers")
+	}
+	if v, ok := m.Get(k(1)); !ok || v != 1 {
+		t.Fatalf("expected %v, got %v", 1, v)
+	}
+	for i := range m.table().mus {
+		m.table().mus[i].RUnlock()
+	}
+}
+
+// BenchmarkGetWithLen measures Gets while another goroutine keeps calling Len.
+func BenchmarkGetWithLen(b *testing.B) {
+	var m Map[int, int]
+	for i := 0; i < 1<<16; i++ {
+		m.Set(i, i)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				m.Len()
+			}
+		}
+	}()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var i int
+		for pb.Next() {
+			m.Get(i & (1<<16 - 1))
+			i++
+		}
+	})
+}
+
+func BenchmarkContains(b *testing.B) {
+	type large struct{ data [1024]byte }
+	var m Map[int, large]
+	for i := 0; i < 1000; i++ {
+		m.Set(i, large{})
+	}
+
+	b.Run("Contains", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			m.Contains(i % 1000)
+		}
+	})
+	b.Run("Get", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = m.Get(i % 1000)
+		}
+	})
+}
+
+func BenchmarkShardCapacity(b *testing.B) {
+	for _, n := range []int{0, 1024} {
+		b.Run(fmt.Sprintf("cap=%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				m := New[int, int](0, WithShards[int, int](16), WithShardCapacity[int, int](n))
+				for j := 0; j < 10000; j++ {
+					m.Set(j, j)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkGrow(b *testing.B) {
+	for _, grow := range []bool{false, true} {
+		b.Run(fmt.Sprintf("grow=%v", grow), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				m := New[int, int](0, WithShards[int, int](16))
+				for j := 0; j < 1000; j++ {
+					m.Set(j, j)
+				}
+				if grow {
+					m.Grow(100000)
+				}
+				for j := 1000; j < 101000; j++ {
+					m.Set(j, j)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package shardmap
+
+import (
+	"time"
+
+	rhh "github.com/johnsiilver/shardmap/v2/hashmap"
+)
+
+// timeNow is the clock used for expiry. Tests replace it.
+var timeNow = time.Now
+
+// State is the result of GetState.
+type State uint8
+
+const (
+	// StateUnknown means the key has no value and is not negatively cached.
+	StateUnknown State = iota
+	// StatePresent means the key has a value.
+	StatePresent
+	// StateNegativeCached means the key was marked absent with SetNegative and the
+	// mark has not expired.
+	StateNegativeCached
+)
+
+// String implements fmt.Stringer.
+func (s State) String() string {
+	switch s {
+	case StatePresent:
+		return "Present"
+	case StateNegativeCached:
+		return "NegativeCached"
+	}
+	return "Unknown"
+}
+
+// SetNegative records that key is known to be absent for ttl, so GetState reports
+// StateNegativeCached instead of StateUnknown until the mark expires. Any value
+// stored for key is deleted. A ttl <= 0 only deletes the value and an existing
+// mark. A later Set of the key removes the mark.
+//
+// Marks are tombstones stored next to the shard's values: each costs about the same
+// memory as an entry with an 8 byte value, but is not counted by Len or returned by
+// iteration. An expired mark is removed the next time the key is looked up with
+// GetState, set or marked again; marks that are never touched again stay until the
+// map is cleared.
+func (m *Map[K, V]) SetNegative(key K, ttl time.Duration) {
+	m.checkWrite()
+	tab, shard := m.lockKey(key)
+	prev, deleted := m.deleteLocked(tab, shard, key)
+	neg := tab.negs[shard]
+	switch {
+	case ttl > 0:
+		if neg == nil {
+			neg = rhh.New[K, int64](0)
+			tab.negs[shard] = neg
+		}
+		neg.Set(key, timeNow().Add(ttl).UnixNano())
+	case neg != nil:
+		neg.Delete(key)
+	}
+	tab.mus[shard].Unlock()
+	if deleted {
+		m.afterDelete(key, prev)
+	}
+}
+
+// GetState returns the value for key and whether the key is present, negatively
+// cached with SetNegative or unknown.
+func (m *Map[K, V]) GetState(key K) (value V, state State) {
+	tab, shard := m.rlockKey(key)
+	value, ok := tab.maps[shard].Get(key)
+	if ok {
+		tab.mus[shard].RUnlock()
+		return value, StatePresent
+	}
+	var exp int64
+	if neg := tab.negs[shard]; neg != nil {
+		exp, ok = neg.Get(key)
+	}
+	tab.mus[shard].RUnlock()
+	if !ok {
+		return value, StateUnknown
+	}
+	if timeNow().UnixNano() < exp {
+		return value, StateNegativeCached
+	}
+
+	// The mark expired, drop it unless it was renewed in the meantime.
+	tab.mus[shard].Lock()
+	defer tab.mus[shard].Unlock()
+	if neg := tab.negs[shard]; neg != nil {
+		if exp, ok := neg.Get(key); ok && timeNow().UnixNano() >= exp {
+			neg.Delete(key)
+		}
+	}
+	return value, StateUnknown
+}
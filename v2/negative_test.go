@@ -0,0 +1,61 @@
+package shardmap
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNegativeCache(t *testing.T) {
+	clock := time.Unix(0, 0)
+	timeNow = func() time.Time { return clock }
+	defer func() { timeNow = time.Now }()
+
+	var m Map[string, int]
+	if _, state := m.GetState("a"); state != StateUnknown {
+		t.Fatalf("expected %v, got %v", StateUnknown, state)
+	}
+	m.Set("a", 1)
+	if v, state := m.GetState("a"); state != StatePresent || v != 1 {
+		t.Fatalf("expected %v, got %v", StatePresent, state)
+	}
+
+	m.SetNegative("a", time.Minute)
+	if _, ok := m.Get("a"); ok {
+		t.Fatal("expected value to be deleted")
+	}
+	if m.Len() != 0 {
+		t.Fatalf("expected %v, got %v", 0, m.Len())
+	}
+	if _, state := m.GetState("a"); state != StateNegativeCached {
+		t.Fatalf("expected %v, got %v", StateNegativeCached, state)
+	}
+
+	clock = clock.Add(time.Minute)
+	if _, state := m.GetState("a"); state != StateUnknown {
+		t.Fatalf("expected %v, got %v", StateUnknown, state)
+	}
+	if m.table().negs[m.choose("a")].Len() != 0 {
+		t.Fatal("expected expired mark to be removed")
+	}
+
+	m.SetNegative("b", time.Minute)
+	m.Set("b", 2)
+	if v, state := m.GetState("b"); state != StatePresent || v != 2 {
+		t.Fatalf("expected %v, got %v", StatePresent, state)
+	}
+	m.Delete("b")
+	if _, state := m.GetState("b"); state != StateUnknown {
+		t.Fatalf("expected %v, got %v", StateUnknown, state)
+	}
+
+	m.SetNegative("c", time.Minute)
+	m.SetNegative("c", 0)
+	if _, state := m.GetState("c"); state != StateUnknown {
+		t.Fatalf("expected %v, got %v", StateUnknown, state)
+	}
+	m.SetNegative("d", time.Minute)
+	m.Clear()
+	if _, state := m.GetState("d"); state != StateUnknown {
+		t.Fatalf("expected %v, got %v", StateUnknown, state)
+	}
+}
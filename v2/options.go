@@ -0,0 +1,54 @@
+package shardmap
+
+// Option configures a Map created by New.
+type Option[K comparable, V any] func(m *Map[K, V])
+
+// WithShardFunc replaces the default hash based shard selection with fn. fn is
+// called with the key and the number of shards and must return a shard index in
+// [0, numShards). It must be deterministic: the same key must always map to the same
+// shard for a given numShards, otherwise entries will be lost. A result outside of
+// the range causes a panic.
+//
+// This allows routing to be fully controlled, such as biasing some keys onto a
+// precomputed set of shards:
+//
+//	m := shardmap.New[int, string](0, shardmap.WithShardFunc[int, string](func(k, n int) int {
+//		return table[k%len(table)] % n
+//	}))
+func WithShardFunc[K comparable, V any](fn func(key K, numShards int) int) Option[K, V] {
+	return func(m *Map[K, V]) {
+		m.shardFn = fn
+	}
+}
+
+// WithShards sets the number of shards instead of deriving it from GOMAXPROCS.
+// Shard selection masks the low bits of the key's hash, so n is rounded up to the
+// next power of two unless WithJumpHash is used, and it is capped at 65536. A small
+// map with little concurrency can use a few shards to save memory, while a map
+// under extreme contention can use more. n <= 0 keeps the default.
+func WithShards[K comparable, V any](n int) Option[K, V] {
+	return func(m *Map[K, V]) {
+		if n <= 0 {
+			m.shards = 0
+			return
+		}
+		m.shards = min(n, maxShards)
+	}
+}
+
+// WithShardCapacity reserves room for at least n entries in every shard when the
+// map is created and when Clear reallocates the shards, instead of only the
+// capacity passed to New divided by the shard count. A shard grows by rehashing
+// all of its entries under its write lock, so a write heavy map that is expected
+// to get large avoids those pauses by starting big.
+//
+// The room is reserved up front in every shard whether it is used or not: the map
+// takes about n times the shard count entries of memory from the start, and
+// entries are not spread perfectly evenly, so some shards may still grow. A room
+// of n holds somewhat fewer than n entries before growing, as shards grow once
+// they are most of the way full. n is capped at 1<<30.
+func WithShardCapacity[K comparable, V any](n int) Option[K, V] {
+	return func(m *Map[K, V]) {
+		m.minCap = max(n, 0)
+	}
+}
@@ -0,0 +1,68 @@
+package shardmap
+
+import rhh "github.com/johnsiilver/shardmap/v2/hashmap"
+
+// revisions holds the revision of every key in a shard. It is guarded by the
+// shard's lock.
+type revisions[K comparable] struct {
+	seq  uint64 // last revision handed out in the shard
+	revs *rhh.Map[K, uint64]
+}
+
+// WithRevisions makes the map track a revision for every entry, which is passed to
+// the callback of SetAcceptRev and returned by GetRev. This allows optimistic
+// concurrency without embedding a version in V: read a value with GetRev, compute
+// the new value without holding any lock, then store it with SetAcceptRev only if
+// the revision has not changed.
+//
+// Every store of a key, by any write method, gives it a new revision. Revisions are
+// drawn from a per-shard counter and never reused, so a key that is deleted and set
+// again does not get back an old revision. Tracking costs a second small map lookup
+// per write.
+func WithRevisions[K comparable, V any]() Option[K, V] {
+	return func(m *Map[K, V]) {
+		m.trackRevs = true
+	}
+}
+
+// GetRev returns the value and revision of key. The revision of an absent key is 0.
+// It panics if the map was not created with WithRevisions.
+func (m *Map[K, V]) GetRev(key K) (value V, rev uint64, ok bool) {
+	m.checkRevs()
+	tab, shard := m.rlockKey(key)
+	defer tab.mus[shard].RUnlock()
+	if value, ok = tab.maps[shard].Get(key); ok {
+		rev, _ = tab.revs[shard].revs.Get(key)
+	}
+	return value, rev, ok
+}
+
+// SetAcceptRev is SetAccept with the entry's current revision passed to accept
+// (0 if the key is absent). A typical accept compares rev to the revision the
+// caller based its new value on and rejects the change if they differ, in which
+// case the caller reads again and retries. Rejected changes are never applied, so
+// they do not change the revision. It panics if the map was not created with
+// WithRevisions.
+func (m *Map[K, V]) SetAcceptRev(key K, value V, accept func(prev V, rev uint64, replaced bool) bool) (prev V, replaced bool) {
+	m.checkWrite()
+	m.checkRevs()
+	return m.setAccept(key, value, func(tab *table[K, V], shard int, prev V, replaced bool) bool {
+		rev, _ := tab.revs[shard].revs.Get(key)
+		return accept(prev, rev, replaced)
+	})
+}
+
+// checkRevs panics if revisions are not tracked.
+func (m *Map[K, V]) checkRevs() {
+	if !m.trackRevs {
+		panic("shardmap: revisions are not tracked, see WithRevisions")
+	}
+}
+
+// setRevLocked gives key in shard a new revision. The caller must hold the shard's
+// write lock.
+func (m *Map[K, V]) setRevLocked(tab *table[K, V], shard int, key K) {
+	r := &tab.revs[shard]
+	r.seq++
+	r.revs.Set(key, r.seq)
+}
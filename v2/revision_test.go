@@ -0,0 +1,66 @@
+package shardmap
+
+import "testing"
+
+func TestRevisions(t *testing.T) {
+	m := New[string, int](0, WithRevisions[string, int]())
+	if _, rev, ok := m.GetRev("a"); ok || rev != 0 {
+		t.Fatalf("expected 0, false, got %v, %v", rev, ok)
+	}
+
+	m.Set("a", 1)
+	_, rev1, ok := m.GetRev("a")
+	if !ok || rev1 == 0 {
+		t.Fatalf("expected a revision, got %v, %v", rev1, ok)
+	}
+
+	// an update based on the current revision is accepted
+	expect := func(want uint64) func(int, uint64, bool) bool {
+		return func(_ int, rev uint64, _ bool) bool { return rev == want }
+	}
+	if _, replaced := m.SetAcceptRev("a", 2, expect(rev1)); !replaced {
+		t.Fatal("expected the change to be accepted")
+	}
+	v, rev2, _ := m.GetRev("a")
+	if v != 2 || rev2 <= rev1 {
+		t.Fatalf("expected 2 with a revision above %v, got %v, %v", rev1, v, rev2)
+	}
+
+	// a stale revision is rejected and does not change the revision
+	if _, replaced := m.SetAcceptRev("a", 3, expect(rev1)); replaced {
+		t.Fatal("expected the change to be rejected")
+	}
+	if v, rev, _ := m.GetRev("a"); v != 2 || rev != rev2 {
+		t.Fatalf("expected 2, %v, got %v, %v", rev2, v, rev)
+	}
+
+	// deleting and setting again never reuses a revision
+	m.Delete("a")
+	if _, rev, _ := m.GetRev("a"); rev != 0 {
+		t.Fatalf("expected %v, got %v", 0, rev)
+	}
+	if _, replaced := m.SetAcceptRev("a", 4, expect(0)); replaced {
+		t.Fatal("expected an insert, got a replace")
+	}
+	if _, rev, _ := m.GetRev("a"); rev <= rev2 {
+		t.Fatalf("expected a revision above %v, got %v", rev2, rev)
+	}
+
+	m.TransformValues(func(_ string, v int) int { return v * 10 })
+	_, rev3, _ := m.GetRev("a")
+	m.Clear()
+	m.Set("a", 1)
+	if _, rev, _ := m.GetRev("a"); rev <= rev3 {
+		t.Fatalf("expected a revision above %v, got %v", rev3, rev)
+	}
+}
+
+func TestRevisionsNotTracked(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a panic")
+		}
+	}()
+	var m Map[string, int]
+	m.GetRev("a")
+}
@@ -0,0 +1,102 @@
+package shardmap
+
+import "hash/maphash"
+
+// WithSeed makes the map place keys on shards using seed instead of a seed chosen
+// at random by New. Maps of the same shard count built with the same seed put a
+// key on the same shard, like maps created with NewLike.
+//
+// A maphash.Seed only exists within one process, so this does not give the same
+// placement from one run of a program to the next; use WithFixedSeed for that.
+func WithSeed[K comparable, V any](seed maphash.Seed) Option[K, V] {
+	return func(m *Map[K, V]) {
+		m.seed = seed
+	}
+}
+
+// WithFixedSeed makes shard placement the same on every run of a program, which
+// removes the run-to-run variation in cache behavior random placement causes in
+// benchmarks and profiles. Keys that are strings or integers are hashed with a
+// fixed hash function. Keys of other types are hashed with maphash and a seed
+// shared by all maps of the process, which is only stable within a run.
+//
+// The random default is there for a reason: with a fixed, public hash function an
+// attacker who controls the keys can choose keys that all land on one shard and
+// turn the map into a single contended lock. Only use WithFixedSeed for keys that
+// are not attacker controlled, such as in benchmarks and tests.
+func WithFixedSeed[K comparable, V any]() Option[K, V] {
+	return func(m *Map[K, V]) {
+		m.hasher = fixedHash[K]
+		m.fixedSeed = true
+	}
+}
+
+// WithHasher makes the map place keys on shards using hash instead of maphash,
+// such as for key types maphash handles poorly or to get a placement that is
+// reproducible in tests. A shard is picked from the low bits of the hash (it is
+// masked with the shard count minus one), so hash must spread keys well over its
+// low bits; a hash that only varies in its high bits puts every key on one shard.
+// hash must be deterministic for the lifetime of the map. The map's seed is not
+// used, and since hash functions cannot be compared the map never shares a shard
+// layout with another one, even one made with NewLike (see LoadParallel).
+func WithHasher[K comparable, V any](hash func(key K) uint64) Option[K, V] {
+	return func(m *Map[K, V]) {
+		m.hasher = hash
+		m.fixedSeed = false
+	}
+}
+
+// processSeed is the seed fixedHash falls back to for keys of other types.
+var processSeed = maphash.MakeSeed()
+
+// fixedHash hashes key without a random seed when its type allows it.
+func fixedHash[K comparable](key K) uint64 {
+	switch k := any(key).(type) {
+	case string:
+		return hashString(k)
+	case int:
+		return mix64(uint64(k))
+	case int8:
+		return mix64(uint64(k))
+	case int16:
+		return mix64(uint64(k))
+	case int32:
+		return mix64(uint64(k))
+	case int64:
+		return mix64(uint64(k))
+	case uint:
+		return mix64(uint64(k))
+	case uint8:
+		return mix64(uint64(k))
+	case uint16:
+		return mix64(uint64(k))
+	case uint32:
+		return mix64(uint64(k))
+	case uint64:
+		return mix64(k)
+	case uintptr:
+		return mix64(uint64(k))
+	}
+	return maphash.Comparable(processSeed, key)
+}
+
+// hashString is 64-bit FNV-1a, finished with mix64 so the low bits that select the
+// shard depend on every byte.
+func hashString(s string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= 1099511628211
+	}
+	return mix64(h)
+}
+
+// mix64 is the splitmix64 finalizer.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,88 @@
+package shardmap
+
+import (
+	"hash/maphash"
+	"testing"
+)
+
+func TestWithSeed(t *testing.T) {
+	seed := maphash.MakeSeed()
+	a := New[string, int](0, WithSeed[string, int](seed))
+	b := New[string, int](0, WithSeed[string, int](seed))
+	a.initDo()
+	b.initDo()
+	if !a.table().aligned(b.table()) {
+		t.Fatal("expected maps with the same seed to be aligned")
+	}
+	for i := 0; i < 1000; i++ {
+		if a.choose(k(i)) != b.choose(k(i)) {
+			t.Fatalf("key %v: expected shard %v, got %v", k(i), a.choose(k(i)), b.choose(k(i)))
+		}
+	}
+}
+
+func TestWithFixedSeed(t *testing.T) {
+	// The placement must not change between runs, so it is pinned here.
+	if got, want := fixedHash("hello"), hashString("hello"); got != want {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	if got, want := hashString(""), mix64(14695981039346656037); got != want {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	if got, want := mix64(1), uint64(0x5692161d100b05e5); got != want {
+		t.Fatalf("expected %#x, got %#x", want, got)
+	}
+	if fixedHash(int8(-1)) != fixedHash(int64(-1)) {
+		t.Fatal("expected signed integers to hash by value")
+	}
+
+	a := New[string, int](0, WithFixedSeed[string, int]())
+	b := New[string, int](0, WithFixedSeed[string, int]())
+	for i := 0; i < 1000; i++ {
+		a.Set(k(i), i)
+		b.Set(k(i), i)
+	}
+	if !a.table().aligned(b.table()) {
+		t.Fatal("expected fixed seed maps to be aligned")
+	}
+	used := map[int]bool{}
+	for i := 0; i < 1000; i++ {
+		shard := a.choose(k(i))
+		if want := int(hashString(k(i)) & uint64(a.table().shards-1)); shard != want {
+			t.Fatalf("key %v: expected shard %v, got %v", k(i), want, shard)
+		}
+		used[shard] = true
+		if v, _ := a.Get(k(i)); v != i {
+			t.Fatalf("expected %v, got %v", i, v)
+		}
+	}
+	if a.table().shards > 1 && len(used) < a.table().shards/2 {
+		t.Fatalf("expected keys spread over the shards, used %d of %d", len(used), a.table().shards)
+	}
+
+	type key struct{ a, b int }
+	c := New[key, int](0, WithFixedSeed[key, int]())
+	c.Set(key{1, 2}, 3)
+	if v, _ := c.Get(key{1, 2}); v != 3 {
+		t.Fatalf("expected %v, got %v", 3, v)
+	}
+}
+
+func TestWithHasher(t *testing.T) {
+	m := New[int, int](0, WithHasher[int, int](func(key int) uint64 { return uint64(key) }))
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	tab := m.table()
+	for i := 0; i < 1000; i++ {
+		if shard := m.choose(i); shard != i&(tab.shards-1) {
+			t.Fatalf("key %v: expected shard %v, got %v", i, i&(tab.shards-1), shard)
+		}
+		if v, ok := m.Get(i); !ok || v != i {
+			t.Fatalf("expected %v, got %v", i, v)
+		}
+	}
+	if n := m.NewLike(); n.table().aligned(tab) {
+		t.Fatal("expected a custom hasher to not be treated as aligned")
+	}
+}
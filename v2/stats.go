@@ -0,0 +1,115 @@
+package shardmap
+
+import (
+	"math"
+	"unsafe"
+)
+
+// ShardStats returns the number of entries of each shard, in shard order. Unlike
+// ShardSizes, which reads the counters without locking, each shard is counted
+// under its read lock, so every count is exact at the time its shard was sampled.
+// An uneven distribution points to hash skew, such as from a poor WithHasher or a
+// pathological key set.
+func (m *Map[K, V]) ShardStats() []int {
+	tab := m.table()
+	stats := make([]int, tab.shards)
+	for i := range stats {
+		tab.mus[i].RLock()
+		stats[i] = tab.maps[i].Len()
+		tab.mus[i].RUnlock()
+	}
+	return stats
+}
+
+// Count returns the number of entries for which match returns true, walking each
+// shard under its read lock without building a result, so match must not write to
+// the map. A nil match counts every entry: unlike Len, which sums counters without
+// locking, each shard is then counted exactly at the time it is visited. Either
+// way the total is consistent per shard but not across shards.
+func (m *Map[K, V]) Count(match func(key K, value V) bool) int {
+	tab := m.table()
+	var n int
+	for i := 0; i < tab.shards; i++ {
+		tab.mus[i].RLock()
+		if match == nil {
+			n += tab.maps[i].Len()
+		} else {
+			for k, v := range tab.maps[i].All() {
+				if match(k, v) {
+					n++
+				}
+			}
+		}
+		tab.mus[i].RUnlock()
+	}
+	return n
+}
+
+// ShardSummary describes the distribution of entries over the shards of a map.
+type ShardSummary struct {
+	// Min and Max are the entry counts of the least and most loaded shards.
+	Min, Max int
+	// Mean is the average number of entries per shard.
+	Mean float64
+	// StdDev is the population standard deviation of the entry counts.
+	StdDev float64
+}
+
+// ShardStatsSummary summarizes ShardStats. A StdDev that is large relative to
+// Mean means some shards are much hotter than others.
+func (m *Map[K, V]) ShardStatsSummary() ShardSummary {
+	stats := m.ShardStats()
+	s := ShardSummary{Min: stats[0], Max: stats[0]}
+	var sum float64
+	for _, n := range stats {
+		s.Min = min(s.Min, n)
+		s.Max = max(s.Max, n)
+		sum += float64(n)
+	}
+	s.Mean = sum / float64(len(stats))
+	var sq float64
+	for _, n := range stats {
+		d := float64(n) - s.Mean
+		sq += d * d
+	}
+	s.StdDev = math.Sqrt(sq / float64(len(stats)))
+	return s
+}
+
+// MemStats is a rough account of the memory held by a map, see Map.MemStats.
+type MemStats struct {
+	// Shards is the number of shards.
+	Shards int
+	// Entries is the number of entries.
+	Entries int
+	// Slots is the number of buckets allocated over all shards, each of which
+	// holds one entry. It is at least Entries; a Slots much larger than Entries
+	// means the shards have room left over, such as after many deletes (see
+	// Shrink).
+	Slots int
+	// SlotBytes estimates the memory of the slots: Slots times the size of a
+	// slot, which holds a key, a value and 8 bytes of hash. Memory that keys and
+	// values refer to, such as the bytes of a string, is not included.
+	SlotBytes int
+}
+
+// MemStats returns an estimate of the memory held by the map, for capacity
+// planning and for spotting bloat. It is not exact heap accounting, but it is a
+// useful relative signal. Each shard is measured under its read lock.
+func (m *Map[K, V]) MemStats() MemStats {
+	tab := m.table()
+	s := MemStats{Shards: tab.shards}
+	for i := 0; i < tab.shards; i++ {
+		tab.mus[i].RLock()
+		s.Entries += tab.maps[i].Len()
+		s.Slots += tab.maps[i].Cap()
+		tab.mus[i].RUnlock()
+	}
+	var slot struct {
+		hdib  uint64
+		value V
+		key   K
+	}
+	s.SlotBytes = s.Slots * int(unsafe.Sizeof(slot))
+	return s
+}
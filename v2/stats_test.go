@@ -0,0 +1,114 @@
+package shardmap
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestShardStats(t *testing.T) {
+	m := New[int, int](0, WithShards[int, int](16))
+	for i := 0; i < 16000; i++ {
+		m.Set(i, i)
+	}
+	if got := m.ShardStats(); !slices.Equal(got, m.ShardSizes()) {
+		t.Fatalf("expected %v, got %v", m.ShardSizes(), got)
+	}
+	balanced := m.ShardStatsSummary()
+	if balanced.Mean != 1000 {
+		t.Fatalf("expected %v, got %v", 1000, balanced.Mean)
+	}
+	if balanced.Min < 800 || balanced.Max > 1200 || balanced.StdDev > 100 {
+		t.Fatalf("expected the default hash to be roughly balanced, got %+v", balanced)
+	}
+
+	// only the low bit varies, so two shards get everything
+	skewed := New[int, int](0, WithShards[int, int](16), WithHasher[int, int](func(key int) uint64 {
+		return uint64(key & 1)
+	}))
+	for i := 0; i < 16000; i++ {
+		skewed.Set(i, i)
+	}
+	s := skewed.ShardStatsSummary()
+	if s.Min != 0 || s.Max != 8000 || s.Mean != 1000 {
+		t.Fatalf("expected min 0, max 8000, mean 1000, got %+v", s)
+	}
+	if s.StdDev < 10*balanced.StdDev {
+		t.Fatalf("expected a skewed deviation, got %v (balanced %v)", s.StdDev, balanced.StdDev)
+	}
+
+	var empty Map[int, int]
+	if s := empty.ShardStatsSummary(); s != (ShardSummary{}) {
+		t.Fatalf("expected a zero summary, got %+v", s)
+	}
+}
+
+func TestCount(t *testing.T) {
+	var m Map[int, int]
+	if n := m.Count(nil); n != 0 {
+		t.Fatalf("expected %v, got %v", 0, n)
+	}
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	if n := m.Count(func(key, value int) bool { return value%10 == 0 }); n != 100 {
+		t.Fatalf("expected %v, got %v", 100, n)
+	}
+	if n := m.Count(func(int, int) bool { return false }); n != 0 {
+		t.Fatalf("expected %v, got %v", 0, n)
+	}
+	if n := m.Count(nil); n != 1000 {
+		t.Fatalf("expected %v, got %v", 1000, n)
+	}
+}
+
+func BenchmarkCount(b *testing.B) {
+	var m Map[int, int]
+	for i := 0; i < 100000; i++ {
+		m.Set(i, i)
+	}
+	match := func(key, value int) bool { return value%10 == 0 }
+
+	b.Run("Count", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			m.Count(match)
+		}
+	})
+	b.Run("RangeComplete", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var n int
+			m.RangeComplete(func(key, value int) bool {
+				if match(key, value) {
+					n++
+				}
+				return true
+			})
+		}
+	})
+}
+
+func TestMemStats(t *testing.T) {
+	m := New[int64, int64](0, WithShards[int64, int64](4))
+	for i := int64(0); i < 10000; i++ {
+		m.Set(i, i)
+	}
+	s := m.MemStats()
+	if s.Shards != 4 || s.Entries != m.Len() {
+		t.Fatalf("expected %v shards and %v entries, got %+v", 4, m.Len(), s)
+	}
+	if s.Slots < s.Entries {
+		t.Fatalf("expected at least %v slots, got %v", s.Entries, s.Slots)
+	}
+	// a slot holds two int64 and the hash
+	if s.SlotBytes != s.Slots*24 {
+		t.Fatalf("expected %v, got %v", s.Slots*24, s.SlotBytes)
+	}
+
+	for i := int64(0); i < 9000; i++ {
+		m.Delete(i)
+	}
+	bloated := m.MemStats()
+	m.Shrink()
+	if shrunk := m.MemStats(); shrunk.Entries != 1000 || shrunk.Slots >= bloated.Slots {
+		t.Fatalf("expected Shrink to reduce %v slots, got %+v", bloated.Slots, shrunk)
+	}
+}
@@ -0,0 +1,91 @@
+package shardmap
+
+// SyncMap is an adapter with the method set of sync.Map, backed by a Map. Code
+// written against sync.Map can switch to it by changing the declaration, with the
+// keys and values now typed, and move over time to the methods of the underlying
+// Map, which the Map method returns. The zero value is empty and ready for use,
+// and a SyncMap must not be copied after first use.
+//
+// Range takes the func(key, value any) bool of sync.Map. CompareAndSwap and
+// CompareAndDelete compare values with ==, so like sync.Map they panic if V is not
+// a comparable type.
+type SyncMap[K comparable, V any] struct {
+	m Map[K, V]
+}
+
+// Map returns the Map that holds the entries of m.
+func (m *SyncMap[K, V]) Map() *Map[K, V] {
+	return &m.m
+}
+
+// Load returns the value stored for key, or the zero value if there is none. ok
+// reports whether a value was found.
+func (m *SyncMap[K, V]) Load(key K) (value V, ok bool) {
+	return m.m.Get(key)
+}
+
+// Store sets the value for key.
+func (m *SyncMap[K, V]) Store(key K, value V) {
+	m.m.Set(key, value)
+}
+
+// LoadOrStore returns the existing value for key if present, with loaded set.
+// Otherwise it stores and returns value, with loaded false.
+func (m *SyncMap[K, V]) LoadOrStore(key K, value V) (actual V, loaded bool) {
+	return m.m.GetOrSet(key, value)
+}
+
+// LoadAndDelete deletes the value for key, returning the previous value if any.
+// loaded reports whether key was present.
+func (m *SyncMap[K, V]) LoadAndDelete(key K) (value V, loaded bool) {
+	return m.m.LoadAndDelete(key)
+}
+
+// Delete deletes the value for key.
+func (m *SyncMap[K, V]) Delete(key K) {
+	m.m.Delete(key)
+}
+
+// Swap stores value for key and returns the previous value if any. loaded
+// reports whether key was present.
+func (m *SyncMap[K, V]) Swap(key K, value V) (previous V, loaded bool) {
+	return m.m.Swap(key, value)
+}
+
+// CompareAndSwap stores new for key if the value stored for key is equal to old.
+// It reports whether new was stored; an absent key is never swapped.
+func (m *SyncMap[K, V]) CompareAndSwap(key K, old, new V) (swapped bool) {
+	return m.m.CompareAndSwapFunc(key, new, func(current V) bool {
+		return any(current) == any(old)
+	})
+}
+
+// CompareAndDelete deletes the entry for key if its value is equal to old. It
+// reports whether the entry was deleted; an absent key is never deleted.
+func (m *SyncMap[K, V]) CompareAndDelete(key K, old V) (deleted bool) {
+	return m.m.CompareAndDeleteFunc(key, func(current V) bool {
+		return any(current) == any(old)
+	})
+}
+
+// Range calls f for each key and value in the map, in no particular order. If f
+// returns false, Range stops.
+//
+// As with sync.Map, Range does not correspond to a consistent snapshot: a value
+// stored or deleted concurrently may or may not be seen. A key is visited at most
+// once unless the shard layout is changed during Range (see ShardIterator). No lock
+// is held while f runs, so f may call any method of m.
+func (m *SyncMap[K, V]) Range(f func(key, value any) bool) {
+	it := m.m.ShardIterator()
+	for {
+		key, value, ok := it.Next()
+		if !ok || !f(key, value) {
+			return
+		}
+	}
+}
+
+// Clear deletes all the entries.
+func (m *SyncMap[K, V]) Clear() {
+	m.m.Clear()
+}
@@ -0,0 +1,149 @@
+package shardmap
+
+import (
+	"sync"
+	"testing"
+)
+
+// syncMapper is the method set shared by sync.Map and SyncMap[any, any], so the
+// same checks run against both.
+type syncMapper interface {
+	Load(key any) (value any, ok bool)
+	Store(key, value any)
+	LoadOrStore(key, value any) (actual any, loaded bool)
+	LoadAndDelete(key any) (value any, loaded bool)
+	Delete(key any)
+	Swap(key, value any) (previous any, loaded bool)
+	CompareAndSwap(key, old, new any) (swapped bool)
+	CompareAndDelete(key, old any) (deleted bool)
+	Range(f func(key, value any) bool)
+	Clear()
+}
+
+var (
+	_ syncMapper = &sync.Map{}
+	_ syncMapper = &SyncMap[any, any]{}
+)
+
+func TestSyncMap(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		m    syncMapper
+	}{
+		{"sync.Map", &sync.Map{}},
+		{"SyncMap", &SyncMap[any, any]{}},
+	} {
+		m := test.m
+		if v, ok := m.Load("a"); ok || v != nil {
+			t.Fatalf("%s: Load of an absent key: expected <nil> false, got %v %v", test.name, v, ok)
+		}
+		m.Store("a", 1)
+		if v, ok := m.Load("a"); !ok || v != 1 {
+			t.Fatalf("%s: Load: expected 1 true, got %v %v", test.name, v, ok)
+		}
+
+		if v, loaded := m.LoadOrStore("a", 2); !loaded || v != 1 {
+			t.Fatalf("%s: LoadOrStore of a present key: expected 1 true, got %v %v", test.name, v, loaded)
+		}
+		if v, loaded := m.LoadOrStore("b", 2); loaded || v != 2 {
+			t.Fatalf("%s: LoadOrStore of an absent key: expected 2 false, got %v %v", test.name, v, loaded)
+		}
+
+		if v, loaded := m.Swap("a", 3); !loaded || v != 1 {
+			t.Fatalf("%s: Swap of a present key: expected 1 true, got %v %v", test.name, v, loaded)
+		}
+		if v, loaded := m.Swap("c", 4); loaded || v != nil {
+			t.Fatalf("%s: Swap of an absent key: expected <nil> false, got %v %v", test.name, v, loaded)
+		}
+
+		if m.CompareAndSwap("a", 1, 5) {
+			t.Fatalf("%s: CompareAndSwap with a wrong old value: expected false", test.name)
+		}
+		if !m.CompareAndSwap("a", 3, 5) {
+			t.Fatalf("%s: CompareAndSwap: expected true", test.name)
+		}
+		if m.CompareAndSwap("z", nil, 1) {
+			t.Fatalf("%s: CompareAndSwap of an absent key: expected false", test.name)
+		}
+		if v, _ := m.Load("a"); v != 5 {
+			t.Fatalf("%s: expected 5, got %v", test.name, v)
+		}
+
+		if m.CompareAndDelete("a", 3) {
+			t.Fatalf("%s: CompareAndDelete with a wrong old value: expected false", test.name)
+		}
+		if !m.CompareAndDelete("a", 5) {
+			t.Fatalf("%s: CompareAndDelete: expected true", test.name)
+		}
+		if m.CompareAndDelete("a", 5) {
+			t.Fatalf("%s: CompareAndDelete of an absent key: expected false", test.name)
+		}
+
+		if v, loaded := m.LoadAndDelete("b"); !loaded || v != 2 {
+			t.Fatalf("%s: LoadAndDelete: expected 2 true, got %v %v", test.name, v, loaded)
+		}
+		if v, loaded := m.LoadAndDelete("b"); loaded || v != nil {
+			t.Fatalf("%s: LoadAndDelete of an absent key: expected <nil> false, got %v %v", test.name, v, loaded)
+		}
+		m.Delete("c")
+		m.Delete("c")
+		if _, ok := m.Load("c"); ok {
+			t.Fatalf("%s: expected c to be deleted", test.name)
+		}
+
+		for i := 0; i < 100; i++ {
+			m.Store(i, i*2)
+		}
+		seen := map[any]any{}
+		m.Range(func(key, value any) bool {
+			if _, ok := seen[key]; ok {
+				t.Fatalf("%s: Range: key %v visited twice", test.name, key)
+			}
+			seen[key] = value
+			m.Delete(key) // f may modify the map
+			return true
+		})
+		if len(seen) != 100 || seen[7] != 14 {
+			t.Fatalf("%s: Range: expected 100 entries with 7: 14, got %v entries with 7: %v", test.name, len(seen), seen[7])
+		}
+		var n int
+		m.Store(1, 1)
+		m.Store(2, 2)
+		m.Range(func(key, value any) bool {
+			n++
+			return false
+		})
+		if n != 1 {
+			t.Fatalf("%s: Range: expected to stop after %v call, got %v", test.name, 1, n)
+		}
+		m.Clear()
+		if _, ok := m.Load(1); ok {
+			t.Fatalf("%s: expected Clear to delete all entries", test.name)
+		}
+	}
+}
+
+func TestSyncMapCompareIncomparable(t *testing.T) {
+	var m SyncMap[string, any]
+	m.Store("a", []int{1})
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a panic comparing incomparable values")
+		}
+	}()
+	m.CompareAndSwap("a", []int{1}, 2)
+}
+
+func TestSyncMapTyped(t *testing.T) {
+	var m SyncMap[string, int]
+	m.Store("a", 1)
+	if v, ok := m.Map().Get("a"); !ok || v != 1 {
+		t.Fatalf("expected %v, got %v", 1, v)
+	}
+	m.Range(func(key, value any) bool {
+		if key.(string) != "a" || value.(int) != 1 {
+			t.Fatalf("expected a 1, got %v %v", key, value)
+		}
+		return true
+	})
+}
@@ -0,0 +1,357 @@
+package shardmap
+
+import (
+	"fmt"
+	"hash/maphash"
+	"sync"
+
+	rhh "github.com/johnsiilver/shardmap/v2/hashmap"
+)
+
+// table is the sharded storage of a Map. The layout of a table (shard count and
+// placement) never changes; Rebuild replaces the table as a whole while holding
+// every shard lock of the old one. Operations on a single key lock their shard and
+// then check that the table is still current, retrying on the new table if not
+// (see lockKey). Operations over every shard enter the Map's layout gate instead,
+// which keeps the table from being replaced until they are done.
+type table[K comparable, V any] struct {
+	shards    int
+	seed      maphash.Seed
+	hasher    func(key K) uint64 // replaces maphash and seed when set
+	fixedSeed bool               // hasher is fixedHash
+	jump      bool               // shards are picked by jumpHash
+	shardFn   func(key K, numShards int) int
+
+	mus    []shardLock
+	maps   []*rhh.Map[K, V]
+	counts []counter
+	negs   []*rhh.Map[K, int64] // SetNegative marks, allocated on first use
+	grown  []*rhh.Map[K, bool]  // values Append allocated, allocated on first use
+	waits  []shardWait          // GetWait waiters
+	revs   []revisions[K]       // entry revisions, nil unless tracked
+	stamps []*rhh.Map[K, int64] // entry store times, nil unless tracked
+	lrus   []lru[K]             // recency order, nil unless WithMaxEntries or WithMaxBytes
+	lruCap int                  // entries a shard holds before evicting, see WithMaxEntries
+
+	bytes   []counter // sum of sizeOf per shard, nil unless WithMaxBytes
+	byteCap int64     // bytes a shard holds before evicting
+}
+
+// newTable returns an empty table for m with the given shard count and seed.
+func (m *Map[K, V]) newTable(shards int, seed maphash.Seed) *table[K, V] {
+	tab := &table[K, V]{
+		shards:    shards,
+		seed:      seed,
+		hasher:    m.hasher,
+		fixedSeed: m.fixedSeed,
+		jump:      m.jump,
+		shardFn:   m.shardFn,
+		mus:       make([]shardLock, shards),
+		maps:      make([]*rhh.Map[K, V], shards),
+		counts:    make([]counter, shards),
+		negs:      make([]*rhh.Map[K, int64], shards),
+		grown:     make([]*rhh.Map[K, bool], shards),
+		waits:     make([]shardWait, shards),
+	}
+	scap := m.shardCap(shards)
+	for i := 0; i < shards; i++ {
+		tab.mus[i].strategy = m.lockStrategy
+		tab.waits[i].cond.L = &tab.mus[i]
+		tab.maps[i] = rhh.New[K, V](scap)
+	}
+	if m.trackRevs {
+		tab.revs = make([]revisions[K], shards)
+	}
+	if m.trackTimes {
+		tab.stamps = make([]*rhh.Map[K, int64], shards)
+	}
+	if m.maxEntries > 0 || m.maxBytes > 0 {
+		tab.lrus = make([]lru[K], shards)
+	}
+	if m.maxEntries > 0 {
+		tab.lruCap = max(1, (m.maxEntries+shards-1)/shards)
+	}
+	if m.maxBytes > 0 {
+		tab.bytes = make([]counter, shards)
+		tab.byteCap = max(1, (m.maxBytes+int64(shards)-1)/int64(shards))
+	}
+	for i := 0; i < shards; i++ {
+		m.resetMetaLocked(tab, i, false)
+	}
+	return tab
+}
+
+func (t *table[K, V]) choose(key K) int {
+	if t.shards == 1 {
+		// every key is in the only shard, there is nothing to hash
+		return 0
+	}
+	if t.shardFn != nil {
+		shard := t.shardFn(key, t.shards)
+		if shard < 0 || shard >= t.shards {
+			panic(fmt.Sprintf("shardmap: shard func returned %d, must be in [0, %d)", shard, t.shards))
+		}
+		return shard
+	}
+	var h uint64
+	if t.hasher != nil {
+		h = t.hasher(key)
+	} else {
+		h = maphash.Comparable(t.seed, key)
+	}
+	if t.jump {
+		return jumpHash(h, t.shards)
+	}
+	return int(h & uint64(t.shards-1))
+}
+
+// aligned reports if a key maps to the same shard index in t and o.
+func (t *table[K, V]) aligned(o *table[K, V]) bool {
+	if t.shards != o.shards || t.jump != o.jump || t.shardFn != nil || o.shardFn != nil {
+		return false
+	}
+	if t.fixedSeed && o.fixedSeed {
+		return true
+	}
+	return t.hasher == nil && o.hasher == nil && t.seed == o.seed
+}
+
+// table returns the current table.
+func (m *Map[K, V]) table() *table[K, V] {
+	m.initDo()
+	return m.tab.Load()
+}
+
+// lockKey write locks the shard key belongs to in the current table and returns
+// the table and the shard index.
+func (m *Map[K, V]) lockKey(key K) (*table[K, V], int) {
+	m.initDo()
+	for {
+		tab := m.tab.Load()
+		shard := tab.choose(key)
+		tab.mus[shard].Lock()
+		if m.tab.Load() == tab {
+			return tab, shard
+		}
+		// replaced while waiting for the lock
+		tab.mus[shard].Unlock()
+	}
+}
+
+// rlockKey is lockKey with a read lock.
+func (m *Map[K, V]) rlockKey(key K) (*table[K, V], int) {
+	m.initDo()
+	for {
+		tab := m.tab.Load()
+		shard := tab.choose(key)
+		tab.mus[shard].RLock()
+		if m.tab.Load() == tab {
+			return tab, shard
+		}
+		tab.mus[shard].RUnlock()
+	}
+}
+
+// holdTable returns the current table and keeps it from being replaced until
+// m.layout.exit is called. It is used by writes that visit every shard.
+func (m *Map[K, V]) holdTable() *table[K, V] {
+	m.initDo()
+	m.layout.enter()
+	return m.tab.Load()
+}
+
+// gate admits any number of holders at once, or one exclusive holder while there
+// are no others. Unlike a sync.RWMutex, an exclusive holder that is waiting does
+// not keep new holders out, so a holder can enter again (say from an eviction
+// handler calling Clear) without deadlocking. The exclusive side can be starved by
+// a constant stream of holders instead, which is acceptable for Rebuild.
+type gate struct {
+	mu      sync.Mutex
+	idle    sync.Cond
+	holders int
+}
+
+func (g *gate) enter() {
+	g.mu.Lock()
+	g.holders++
+	g.mu.Unlock()
+}
+
+func (g *gate) exit() {
+	g.mu.Lock()
+	g.holders--
+	if g.holders == 0 {
+		g.idle.Broadcast()
+	}
+	g.mu.Unlock()
+}
+
+// lock waits for the holders to leave and keeps everyone out until unlock.
+func (g *gate) lock() {
+	g.mu.Lock()
+	g.idle.L = &g.mu
+	for g.holders > 0 {
+		g.idle.Wait()
+	}
+}
+
+func (g *gate) unlock() {
+	g.mu.Unlock()
+}
+
+// Rebuild migrates every entry of the map in a single pass: each entry is passed to
+// transform and the key/value it returns is stored in fresh shards, placed using
+// newSeed. This both rehashes the map and rewrites its entries, including their
+// keys, without a second pass. A nil transform only rehashes. If transform returns
+// the same key for several entries, one of them is kept. Negative cache marks are
+// moved to the new shards unchanged, revisions are carried over with the
+// transformed key and store times are kept.
+//
+// Rebuild is a stop-the-world operation on the map: it waits for operations over
+// every shard (Clear, Transact, ...) to finish, then holds every shard's write lock
+// while it runs transform on all entries, so every other operation on the map
+// waits for it. Subscribers and the eviction handler are not notified; to them
+// Rebuild is a migration rather than a change. The exception are entries evicted
+// because a new shard is over its bound of WithMaxEntries or WithMaxBytes, which
+// are reported with EvictOverflow once the map is unlocked. transform must not
+// call into the map. A map with a custom hash (WithFixedSeed) or WithShardFunc
+// places keys without a seed, so newSeed only matters when the entries are
+// transformed.
+func (m *Map[K, V]) Rebuild(newSeed maphash.Seed, transform func(key K, value V) (K, V)) {
+	m.checkWrite()
+	m.migrate(0, newSeed, transform)
+}
+
+// Resize changes the number of shards to n, rounded up to a power of two (unless
+// WithJumpHash is used) and capped like WithShards, and moves every entry to the
+// shard it belongs to in the new layout. A map whose concurrency changes over its
+// life, such as a server that grows its worker pool, can pick a shard count that
+// fits. n <= 0 picks the default for the current GOMAXPROCS.
+//
+// Like Rebuild, Resize is a stop-the-world operation that holds every shard's
+// write lock while it copies the whole map, so every other operation on the map
+// waits for it; it is meant to be called rarely. Entries, negative cache marks,
+// revisions and store times are kept, and subscribers and the eviction handler are
+// not notified, except of the entries evicted to fit the bounds of the new shards
+// as in Rebuild.
+func (m *Map[K, V]) Resize(n int) {
+	m.checkWrite()
+	if n <= 0 {
+		n = shardCount(numProcs())
+	}
+	m.migrate(m.fitShards(n), maphash.Seed{}, nil)
+}
+
+// migrate replaces the table with one of the given shard count and seed, where 0
+// and the zero seed keep those of the current table, and moves every entry into it
+// through transform (see Rebuild).
+func (m *Map[K, V]) migrate(shards int, seed maphash.Seed, transform func(key K, value V) (K, V)) {
+	m.initDo()
+	var evicted []kv[K, V]
+	// deferred first so the eviction handler runs once the layout gate is open
+	defer func() {
+		for _, e := range evicted {
+			m.afterRemove(e.key, e.value, EvictOverflow)
+		}
+	}()
+	m.layout.lock()
+	defer m.layout.unlock()
+
+	if transform == nil {
+		transform = func(key K, value V) (K, V) { return key, value }
+	}
+	old := m.tab.Load()
+	for i := range old.mus {
+		old.mus[i].Lock()
+	}
+	if shards == 0 {
+		shards = old.shards
+	}
+	if seed == (maphash.Seed{}) {
+		seed = old.seed
+	}
+	tab := m.newTable(shards, seed)
+	var released []K
+	func() {
+		defer func() {
+			for i := range old.mus {
+				old.mus[i].Unlock()
+			}
+		}()
+		var seq uint64
+		for i := 0; i < old.shards; i++ {
+			if old.revs != nil {
+				seq = max(seq, old.revs[i].seq)
+			}
+		}
+		for i := 0; i < old.shards; i++ {
+			for k, v := range old.maps[i].All() {
+				nk, nv := transform(k, v)
+				if m.interner != nil {
+					nk = m.interner.intern(nk)
+					if nk != k {
+						released = append(released, k)
+					}
+				}
+				shard := tab.choose(nk)
+				prev, replaced := tab.maps[shard].Set(nk, nv)
+				if tab.bytes != nil {
+					size := m.sizeOf(nk, nv)
+					if replaced {
+						size -= m.sizeOf(nk, prev)
+					}
+					tab.bytes[shard].Add(size)
+				}
+				if !replaced {
+					tab.counts[shard].Add(1)
+					if m.card != nil {
+						m.card.add(maphash.Comparable(m.card.seed, nk))
+					}
+				}
+				if tab.revs != nil {
+					rev, _ := old.revs[i].revs.Get(k)
+					tab.revs[shard].revs.Set(nk, rev)
+				}
+				if tab.stamps != nil {
+					stamp, _ := old.stamps[i].Get(k)
+					tab.stamps[shard].Set(nk, stamp)
+				}
+				if tab.lrus != nil {
+					tab.lrus[shard].use(nk)
+				}
+			}
+			if neg := old.negs[i]; neg != nil {
+				for k, exp := range neg.All() {
+					shard := tab.choose(k)
+					if tab.negs[shard] == nil {
+						tab.negs[shard] = rhh.New[K, int64](0)
+					}
+					tab.negs[shard].Set(k, exp)
+				}
+			}
+		}
+		if tab.revs != nil {
+			for i := range tab.revs {
+				tab.revs[i].seq = seq
+			}
+		}
+		if tab.lrus != nil {
+			// the new shards can have a smaller share of the bound than the old ones
+			for i := 0; i < tab.shards; i++ {
+				evicted = m.evictLocked(tab, i, evicted)
+			}
+		}
+		m.tab.Store(tab)
+		// GetWait callers sleeping on the old table must move to the new one.
+		for i := range old.waits {
+			old.waits[i].cond.Broadcast()
+		}
+	}()
+
+	// An old key is only released if no entry was migrated to it.
+	for _, k := range released {
+		if _, ok := m.Get(k); !ok {
+			m.interner.release(k)
+		}
+	}
+}
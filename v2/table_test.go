@@ -0,0 +1,197 @@
+package shardmap
+
+import (
+	"hash/maphash"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRebuild(t *testing.T) {
+	m := New[string, int](0)
+	for i := 0; i < 1000; i++ {
+		m.Set(k(i), i)
+	}
+	old := m.table()
+	seed := maphash.MakeSeed()
+	m.Rebuild(seed, func(key string, value int) (string, int) {
+		return "x" + key, value * 2
+	})
+	if m.table() == old {
+		t.Fatal("expected a new table")
+	}
+	if m.table().seed != seed {
+		t.Fatal("expected the new seed to be used")
+	}
+	if m.Len() != 1000 {
+		t.Fatalf("expected %v, got %v", 1000, m.Len())
+	}
+	for i := 0; i < 1000; i++ {
+		if _, ok := m.Get(k(i)); ok {
+			t.Fatalf("key %v: expected old key to be gone", k(i))
+		}
+		if v, ok := m.Get("x" + k(i)); !ok || v != i*2 {
+			t.Fatalf("key %v: expected %v, got %v", "x"+k(i), i*2, v)
+		}
+	}
+	// every key must be in the shard the new seed places it in
+	tab := m.table()
+	for i := 0; i < tab.shards; i++ {
+		for key := range tab.maps[i].All() {
+			if tab.choose(key) != i {
+				t.Fatalf("key %v: expected shard %v, got %v", key, tab.choose(key), i)
+			}
+		}
+	}
+
+	// a nil transform only rehashes
+	m.Rebuild(maphash.MakeSeed(), nil)
+	if v, ok := m.Get("x" + k(7)); !ok || v != 14 {
+		t.Fatalf("expected %v, got %v", 14, v)
+	}
+
+	// keys that collide after the transform are kept once
+	m.Rebuild(maphash.MakeSeed(), func(key string, value int) (string, int) {
+		return strings.TrimRight(key, "0123456789"), value
+	})
+	if m.Len() != 1 {
+		t.Fatalf("expected %v, got %v", 1, m.Len())
+	}
+	if _, ok := m.Get("x"); !ok {
+		t.Fatal("expected the collided key to be present")
+	}
+}
+
+func TestRebuildMeta(t *testing.T) {
+	m := New[string, int](0, WithRevisions[string, int](), WithTimestamps[string, int]())
+	m.Set("a", 1)
+	m.Set("a", 2)
+	_, rev, _ := m.GetRev("a")
+	stored, _ := m.StoredAt("a")
+
+	m.Rebuild(maphash.MakeSeed(), func(key string, value int) (string, int) {
+		return strings.ToUpper(key), value
+	})
+	if _, got, ok := m.GetRev("A"); !ok || got != rev {
+		t.Fatalf("expected %v, got %v", rev, got)
+	}
+	if got, ok := m.StoredAt("A"); !ok || !got.Equal(stored) {
+		t.Fatalf("expected %v, got %v", stored, got)
+	}
+	m.Set("b", 1)
+	if _, got, _ := m.GetRev("b"); got <= rev {
+		t.Fatalf("expected a revision after %v, got %v", rev, got)
+	}
+}
+
+func TestRebuildConcurrent(t *testing.T) {
+	m := New[string, int](0)
+	for i := 0; i < 1000; i++ {
+		m.Set(k(i), i)
+	}
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				key := k(i % 1000)
+				if v, ok := m.Get(key); !ok || v != i%1000 {
+					t.Errorf("key %v: expected %v, got %v", key, i%1000, v)
+					return
+				}
+				m.Set(key, i%1000)
+				m.Len()
+			}
+		}(w)
+	}
+	for i := 0; i < 20; i++ {
+		m.Rebuild(maphash.MakeSeed(), nil)
+	}
+	close(stop)
+	wg.Wait()
+	if m.Len() != 1000 {
+		t.Fatalf("expected %v, got %v", 1000, m.Len())
+	}
+}
+
+func TestResize(t *testing.T) {
+	m := New[string, int](0, WithShards[string, int](4))
+	for i := 0; i < 1000; i++ {
+		m.Set(k(i), i)
+	}
+	seed := m.table().seed
+	for _, test := range []struct{ n, want int }{{100, 128}, {1, 1}, {16, 16}} {
+		m.Resize(test.n)
+		tab := m.table()
+		if tab.shards != test.want {
+			t.Fatalf("Resize(%d): expected %v shards, got %v", test.n, test.want, tab.shards)
+		}
+		if tab.seed != seed {
+			t.Fatalf("Resize(%d): expected the seed to be kept", test.n)
+		}
+		if m.Len() != 1000 {
+			t.Fatalf("Resize(%d): expected %v, got %v", test.n, 1000, m.Len())
+		}
+		for i := 0; i < tab.shards; i++ {
+			for key := range tab.maps[i].All() {
+				if tab.choose(key) != i {
+					t.Fatalf("Resize(%d): key %v: expected shard %v, got %v", test.n, key, tab.choose(key), i)
+				}
+			}
+		}
+		for i := 0; i < 1000; i++ {
+			if v, ok := m.Get(k(i)); !ok || v != i {
+				t.Fatalf("Resize(%d): key %v: expected %v, got %v", test.n, k(i), i, v)
+			}
+		}
+	}
+	m.Resize(0)
+	if m.table().shards != shardCount(numProcs()) {
+		t.Fatalf("expected %v, got %v", shardCount(numProcs()), m.table().shards)
+	}
+}
+
+func TestResizeConcurrent(t *testing.T) {
+	var m Map[int, int]
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				key := w*1000 + i%1000
+				m.Set(key, i)
+				if v, ok := m.Get(key); !ok || v != i {
+					t.Errorf("key %v: expected %v, got %v", key, i, v)
+					return
+				}
+			}
+		}(w)
+	}
+	for i := 0; i < 20; i++ {
+		m.Resize(1 << (i % 8))
+	}
+	close(stop)
+	wg.Wait()
+	if m.Len() > 4000 {
+		t.Fatalf("expected at most %v, got %v", 4000, m.Len())
+	}
+	for _, key := range m.Keys() {
+		if _, ok := m.Get(key); !ok {
+			t.Fatalf("key %v: expected to be reachable", key)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package shardmap
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WithTimestamps makes the map record when every entry was last stored, which
+// StoredAt reports and PurgeOlderThan uses. Any write that stores a value,
+// including replacing one, updates the time. Tracking costs a clock read and a
+// second small map update per write.
+func WithTimestamps[K comparable, V any]() Option[K, V] {
+	return func(m *Map[K, V]) {
+		m.trackTimes = true
+	}
+}
+
+// StoredAt returns the time key was last stored. It returns false if key is not
+// present and panics if the map was not created with WithTimestamps.
+func (m *Map[K, V]) StoredAt(key K) (time.Time, bool) {
+	m.checkTimes()
+	tab, shard := m.rlockKey(key)
+	stamp, ok := tab.stamps[shard].Get(key)
+	tab.mus[shard].RUnlock()
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(0, stamp), true
+}
+
+// PurgeOlderThan deletes every entry that was last stored before t and returns the
+// number of entries deleted. It panics if the map was not created with
+// WithTimestamps.
+//
+// Shards are swept in parallel by up to GOMAXPROCS goroutines, each holding one
+// shard's write lock while it scans the shard's timestamps. The eviction handler
+// is called with EvictExpired for every purged entry after its shard is unlocked,
+// from several goroutines at once. The scan reads the times directly, so no
+// callback is made per entry.
+func (m *Map[K, V]) PurgeOlderThan(t time.Time) int {
+	m.checkWrite()
+	m.checkTimes()
+	tab := m.holdTable()
+	defer m.layout.exit()
+	cutoff := t.UnixNano()
+	workers := min(runtime.GOMAXPROCS(0), tab.shards)
+
+	var next, total atomic.Int64
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var old []K
+			var purged []kv[K, V]
+			for {
+				shard := int(next.Add(1) - 1)
+				if shard >= tab.shards {
+					return
+				}
+				old, purged = old[:0], purged[:0]
+				tab.mus[shard].Lock()
+				for key, stamp := range tab.stamps[shard].All() {
+					if stamp < cutoff {
+						old = append(old, key)
+					}
+				}
+				for _, key := range old {
+					if prev, ok := m.deleteLocked(tab, shard, key); ok {
+						purged = append(purged, kv[K, V]{key, prev})
+					}
+				}
+				tab.mus[shard].Unlock()
+				for _, e := range purged {
+					m.afterRemove(e.key, e.value, EvictExpired)
+				}
+				total.Add(int64(len(purged)))
+			}
+		}()
+	}
+	wg.Wait()
+	return int(total.Load())
+}
+
+// checkTimes panics if store times are not tracked.
+func (m *Map[K, V]) checkTimes() {
+	if !m.trackTimes {
+		panic("shardmap: timestamps are not tracked, see WithTimestamps")
+	}
+}
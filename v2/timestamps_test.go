@@ -0,0 +1,54 @@
+package shardmap
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPurgeOlderThan(t *testing.T) {
+	clock := time.Unix(1000, 0)
+	timeNow = func() time.Time { return clock }
+	defer func() { timeNow = time.Now }()
+
+	var expired atomic.Int64
+	m := New[string, int](0, WithTimestamps[string, int](), WithEvictionHandler(func(_ string, _ int, reason EvictReason) {
+		if reason == EvictExpired {
+			expired.Add(1)
+		}
+	}))
+	for i := 0; i < 100; i++ {
+		m.Set(k(i), i)
+	}
+	clock = clock.Add(time.Minute)
+	for i := 100; i < 150; i++ {
+		m.Set(k(i), i)
+	}
+	// storing again refreshes the time
+	m.Set(k(0), 0)
+	if at, ok := m.StoredAt(k(0)); !ok || !at.Equal(clock) {
+		t.Fatalf("expected %v, got %v", clock, at)
+	}
+
+	if n := m.PurgeOlderThan(clock); n != 99 {
+		t.Fatalf("expected %v, got %v", 99, n)
+	}
+	if m.Len() != 51 {
+		t.Fatalf("expected %v, got %v", 51, m.Len())
+	}
+	if _, ok := m.Get(k(1)); ok {
+		t.Fatalf("expected %v to be purged", k(1))
+	}
+	if _, ok := m.Get(k(0)); !ok {
+		t.Fatalf("expected %v to be kept", k(0))
+	}
+	if _, ok := m.StoredAt(k(1)); ok {
+		t.Fatal("expected no time for a purged key")
+	}
+	if expired.Load() != 99 {
+		t.Fatalf("expected %v, got %v", 99, expired.Load())
+	}
+	if n := m.PurgeOlderThan(clock); n != 0 {
+		t.Fatalf("expected %v, got %v", 0, n)
+	}
+}
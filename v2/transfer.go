@@ -0,0 +1,54 @@
+package shardmap
+
+import "unsafe"
+
+// Transfer moves key from src to dst: it deletes the entry from src and stores
+// its value in dst, overwriting a value dst holds for key. It returns the moved
+// value and true, or false if src does not hold key, in which case neither map is
+// changed. Transfer of a map to itself returns the value without changing the map.
+//
+// The shard of key is write locked in both maps for the whole move, so no reader
+// can see the entry in both maps or in neither. Deadlocks are avoided by always
+// locking the map at the lower address first, which makes transfers in opposite
+// directions between the same two maps, on any keys, safe to run concurrently. No
+// other operation holds locks of two maps at once. For the handlers of each map
+// the move is a delete from src followed by a store in dst.
+func Transfer[K comparable, V any](src, dst *Map[K, V], key K) (value V, moved bool) {
+	if src == dst {
+		return src.Get(key)
+	}
+	src.checkWrite()
+	dst.checkWrite()
+	if dst.interner != nil {
+		key = dst.interner.intern(key)
+	}
+
+	var stab, dtab *table[K, V]
+	var sshard, dshard int
+	if uintptr(unsafe.Pointer(src)) < uintptr(unsafe.Pointer(dst)) {
+		stab, sshard = src.lockKey(key)
+		dtab, dshard = dst.lockKey(key)
+	} else {
+		dtab, dshard = dst.lockKey(key)
+		stab, sshard = src.lockKey(key)
+	}
+	var prev V
+	var replaced bool
+	value, moved = src.deleteLocked(stab, sshard, key)
+	if moved {
+		prev, replaced = dst.setLocked(dtab, dshard, key, value)
+	} else {
+		replaced = dtab.maps[dshard].Contains(key)
+	}
+	stab.mus[sshard].Unlock()
+	dtab.mus[dshard].Unlock()
+
+	switch {
+	case moved:
+		src.afterDelete(key, value)
+		dst.afterSet(key, value, prev, replaced)
+	case !replaced && dst.interner != nil:
+		dst.interner.release(key)
+	}
+	return value, moved
+}
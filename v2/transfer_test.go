@@ -0,0 +1,74 @@
+package shardmap
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestTransfer(t *testing.T) {
+	var src, dst Map[string, int]
+	src.Set("a", 1)
+	dst.Set("b", 2)
+	if v, moved := Transfer(&src, &dst, "a"); !moved || v != 1 {
+		t.Fatalf("expected %v/%v, got %v/%v", 1, true, v, moved)
+	}
+	if src.Contains("a") || src.Len() != 0 {
+		t.Fatal("expected a to be deleted from src")
+	}
+	if v, ok := dst.Get("a"); !ok || v != 1 || dst.Len() != 2 {
+		t.Fatalf("expected a: 1 in dst, got %v/%v with Len %v", v, ok, dst.Len())
+	}
+
+	// an absent key changes nothing
+	if v, moved := Transfer(&src, &dst, "b"); moved || v != 0 {
+		t.Fatalf("expected %v/%v, got %v/%v", 0, false, v, moved)
+	}
+	if v, _ := dst.Get("b"); v != 2 {
+		t.Fatalf("expected %v, got %v", 2, v)
+	}
+
+	// a value in dst is overwritten
+	src.Set("b", 3)
+	Transfer(&src, &dst, "b")
+	if v, _ := dst.Get("b"); v != 3 || dst.Len() != 2 {
+		t.Fatalf("expected %v with Len %v, got %v with Len %v", 3, 2, v, dst.Len())
+	}
+
+	if v, moved := Transfer(&dst, &dst, "b"); !moved || v != 3 || dst.Len() != 2 {
+		t.Fatalf("expected a transfer to itself to leave the map alone, got %v/%v", v, moved)
+	}
+}
+
+func TestTransferConcurrent(t *testing.T) {
+	a, b := New[int, int](0), New[int, int](0)
+	const n = 100
+	for i := 0; i < n; i++ {
+		a.Set(i, i)
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			src, dst := a, b
+			if w%2 == 1 {
+				src, dst = b, a
+			}
+			for i := 0; i < 2000; i++ {
+				key := i % n
+				if v, moved := Transfer(src, dst, key); moved && v != key {
+					t.Errorf("key %v: expected %v, got %v", key, key, v)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	if a.Len()+b.Len() != n {
+		t.Fatalf("expected %v entries in total, got %v", n, a.Len()+b.Len())
+	}
+	for i := 0; i < n; i++ {
+		if a.Contains(i) == b.Contains(i) {
+			t.Fatalf("key %v: expected to be in exactly one map", i)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package shardmap
+
+import (
+	"sync"
+	"time"
+)
+
+// TTLMap is a Map whose entries can expire. An entry stored with SetWithTTL is
+// treated as absent by Get once its time to live has passed, and a background
+// janitor deletes expired entries so they do not hold memory. Call Close to stop
+// the janitor once the map is no longer used.
+//
+// Expired entries are only removed by the janitor (or PurgeExpired), so until the
+// next sweep they still count towards Len.
+type TTLMap[K comparable, V any] struct {
+	m         *Map[K, expiring[V]]
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// expiring is a value with the time it expires at, in Unix nanoseconds. An expiry
+// of 0 never expires.
+type expiring[V any] struct {
+	value   V
+	expires int64
+}
+
+func (e expiring[V]) expired(now int64) bool {
+	return e.expires != 0 && now >= e.expires
+}
+
+// NewTTL returns a new TTLMap with the specified capacity and options (see New). Its
+// janitor sweeps every shard for expired entries every interval; an interval <= 0
+// starts no janitor, leaving expired entries in place until PurgeExpired is called.
+// The janitor and PurgeExpired call the eviction handler with EvictExpired. The
+// handlers, hooks and WithMaxBytes see values as they were stored, without expiry.
+func NewTTL[K comparable, V any](cap int, interval time.Duration, opts ...Option[K, V]) *TTLMap[K, V] {
+	t := &TTLMap[K, V]{
+		m:    New(cap, expiringOption(opts)),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	if interval <= 0 {
+		close(t.done)
+		return t
+	}
+	go t.janitor(interval)
+	return t
+}
+
+// expiringOption applies opts, which are written for a Map[K, V], to the map of a
+// TTLMap, wrapping the functions that take a value so they are passed the value of
+// an expiring entry.
+func expiringOption[K comparable, V any](opts []Option[K, V]) Option[K, expiring[V]] {
+	var o Map[K, V]
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return func(m *Map[K, expiring[V]]) {
+		m.minCap = o.minCap
+		m.maxEntries = o.maxEntries
+		m.maxBytes = o.maxBytes
+		m.shards = o.shards
+		m.seed = o.seed
+		m.hasher = o.hasher
+		m.fixedSeed = o.fixedSeed
+		m.jump = o.jump
+		m.trackRevs = o.trackRevs
+		m.trackTimes = o.trackTimes
+		m.shardFn = o.shardFn
+		m.interner = o.interner
+		m.card = o.card
+		m.lockStrategy = o.lockStrategy
+		if o.sizeOf != nil {
+			m.sizeOf = func(key K, e expiring[V]) int64 {
+				return o.sizeOf(key, e.value)
+			}
+		}
+		if o.onEvict != nil {
+			m.onEvict = func(key K, e expiring[V], reason EvictReason) {
+				o.onEvict(key, e.value, reason)
+			}
+		}
+		if o.onSet != nil {
+			m.onSet = func(key K, newV, oldV expiring[V], replaced bool) {
+				o.onSet(key, newV.value, oldV.value, replaced)
+			}
+		}
+		if o.onDelete != nil {
+			m.onDelete = func(key K, oldV expiring[V], deleted bool) {
+				o.onDelete(key, oldV.value, deleted)
+			}
+		}
+	}
+}
+
+func (t *TTLMap[K, V]) janitor(interval time.Duration) {
+	defer close(t.done)
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-tick.C:
+			t.PurgeExpired()
+		}
+	}
+}
+
+// Close stops the janitor and waits for a sweep in progress to finish. The map
+// itself stays usable, but expired entries are no longer deleted in the
+// background. Close may be called more than once.
+func (t *TTLMap[K, V]) Close() {
+	t.closeOnce.Do(func() { close(t.stop) })
+	<-t.done
+}
+
+// SetWithTTL assigns a value to a key that expires after ttl, replacing the value
+// and the expiry of an existing entry. A ttl <= 0 stores an entry that never
+// expires. Returns the previous value, or false when no unexpired value was
+// assigned. An expired entry is first removed as by the janitor, reported with
+// EvictExpired, so to the hooks the new value replaces nothing.
+func (t *TTLMap[K, V]) SetWithTTL(key K, value V, ttl time.Duration) (prev V, replaced bool) {
+	now := timeNow().UnixNano()
+	e := expiring[V]{value: value}
+	if ttl > 0 {
+		e.expires = now + int64(ttl)
+	}
+	m := t.m
+	m.checkWrite()
+	if m.interner != nil {
+		key = m.interner.intern(key)
+	}
+	tab, shard := m.lockKey(key)
+	old, expired := tab.maps[shard].Get(key)
+	expired = expired && old.expired(now)
+	if expired {
+		m.deleteLocked(tab, shard, key)
+	}
+	cur, replaced := m.setLocked(tab, shard, key, e)
+	tab.mus[shard].Unlock()
+	if expired {
+		// the key stays in the map, so it is not released like a removed one
+		m.notifyRemove(key, old, EvictExpired)
+	}
+	m.afterSet(key, e, cur, replaced)
+	if !replaced {
+		return prev, false
+	}
+	return cur.value, true
+}
+
+// Set assigns a value to a key that never expires. It is SetWithTTL with a ttl
+// of 0.
+func (t *TTLMap[K, V]) Set(key K, value V) (prev V, replaced bool) {
+	return t.SetWithTTL(key, value, 0)
+}
+
+// Get returns the value for a key. Returns false when no value has been
+// assigned or the value has expired.
+func (t *TTLMap[K, V]) Get(key K) (value V, ok bool) {
+	e, ok := t.m.Get(key)
+	if !ok || e.expired(timeNow().UnixNano()) {
+		return value, false
+	}
+	return e.value, true
+}
+
+// Delete deletes the value for a key. Returns the deleted value, or false when no
+// unexpired value was assigned. An expired entry is removed as by the janitor and
+// reported with EvictExpired.
+func (t *TTLMap[K, V]) Delete(key K) (prev V, deleted bool) {
+	now := timeNow().UnixNano()
+	m := t.m
+	m.checkWrite()
+	tab, shard := m.lockKey(key)
+	e, deleted := m.deleteLocked(tab, shard, key)
+	tab.mus[shard].Unlock()
+	switch {
+	case deleted && e.expired(now):
+		m.afterRemove(key, e, EvictExpired)
+		return prev, false
+	case deleted:
+		m.afterDelete(key, e)
+		return e.value, true
+	case m.onDelete != nil:
+		m.onDelete(key, e, false)
+	}
+	return prev, false
+}
+
+// Len returns the number of entries, including expired entries that have not been
+// deleted yet.
+func (t *TTLMap[K, V]) Len() int {
+	return t.m.Len()
+}
+
+// PurgeExpired deletes every expired entry now and returns how many were deleted.
+// It is what the janitor runs; each shard is swept under its write lock in turn.
+func (t *TTLMap[K, V]) PurgeExpired() int {
+	now := timeNow().UnixNano()
+	m := t.m
+	tab := m.holdTable()
+	defer m.layout.exit()
+	var n int
+	var expired []K
+	var purged []kv[K, expiring[V]]
+	for i := 0; i < tab.shards; i++ {
+		expired, purged = expired[:0], purged[:0]
+		tab.mus[i].Lock()
+		for k, e := range tab.maps[i].All() {
+			if e.expired(now) {
+				expired = append(expired, k)
+			}
+		}
+		for _, k := range expired {
+			if prev, ok := m.deleteLocked(tab, i, k); ok {
+				purged = append(purged, kv[K, expiring[V]]{k, prev})
+			}
+		}
+		tab.mus[i].Unlock()
+		for _, e := range purged {
+			m.afterRemove(e.key, e.value, EvictExpired)
+		}
+		n += len(purged)
+	}
+	return n
+}
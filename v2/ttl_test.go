@@ -0,0 +1,165 @@
+package shardmap
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTTLMap(t *testing.T) {
+	clock := time.Unix(1000, 0)
+	timeNow = func() time.Time { return clock }
+	defer func() { timeNow = time.Now }()
+
+	m := NewTTL[string, int](0, 0)
+	defer m.Close()
+	m.SetWithTTL("a", 1, time.Minute)
+	m.SetWithTTL("b", 2, 2*time.Minute)
+	m.Set("c", 3)
+	if v, ok := m.Get("a"); !ok || v != 1 {
+		t.Fatalf("expected %v, got %v", 1, v)
+	}
+
+	clock = clock.Add(time.Minute)
+	if _, ok := m.Get("a"); ok {
+		t.Fatal("expected a to have expired")
+	}
+	if v, ok := m.Get("b"); !ok || v != 2 {
+		t.Fatalf("expected %v, got %v", 2, v)
+	}
+	// re-setting b resets its expiry
+	if prev, replaced := m.SetWithTTL("b", 4, 2*time.Minute); !replaced || prev != 2 {
+		t.Fatalf("expected %v, got %v", 2, prev)
+	}
+	// setting an expired key reports no previous value
+	if _, replaced := m.SetWithTTL("a", 5, time.Minute); replaced {
+		t.Fatal("expected an expired value to not be reported as replaced")
+	}
+
+	clock = clock.Add(90 * time.Second)
+	if _, ok := m.Get("a"); ok {
+		t.Fatal("expected a to have expired again")
+	}
+	if v, ok := m.Get("b"); !ok || v != 4 {
+		t.Fatalf("expected %v, got %v", 4, v)
+	}
+	if m.Len() != 3 {
+		t.Fatalf("expected %v, got %v", 3, m.Len())
+	}
+	if n := m.PurgeExpired(); n != 1 {
+		t.Fatalf("expected %v, got %v", 1, n)
+	}
+	if m.Len() != 2 {
+		t.Fatalf("expected %v, got %v", 2, m.Len())
+	}
+
+	clock = clock.Add(time.Hour)
+	if _, deleted := m.Delete("b"); deleted {
+		t.Fatal("expected deleting an expired value to report false")
+	}
+	if v, ok := m.Get("c"); !ok || v != 3 {
+		t.Fatalf("expected %v, got %v", 3, v)
+	}
+}
+
+func TestTTLMapOptions(t *testing.T) {
+	clock := time.Unix(1000, 0)
+	timeNow = func() time.Time { return clock }
+	defer func() { timeNow = time.Now }()
+
+	evicted := map[string]int{}
+	m := NewTTL[string, int](0, 0,
+		WithShards[string, int](1),
+		WithEvictionHandler(func(key string, value int, reason EvictReason) {
+			if reason == EvictExpired {
+				evicted[key] = value
+			}
+		}),
+	)
+	defer m.Close()
+	if got := m.m.Shards(); got != 1 {
+		t.Fatalf("expected %v, got %v", 1, got)
+	}
+	m.SetWithTTL("a", 1, time.Minute)
+	m.Set("b", 2)
+
+	clock = clock.Add(time.Minute)
+	if n := m.PurgeExpired(); n != 1 {
+		t.Fatalf("expected %v, got %v", 1, n)
+	}
+	if len(evicted) != 1 || evicted["a"] != 1 {
+		t.Fatalf("expected %v, got %v", map[string]int{"a": 1}, evicted)
+	}
+}
+
+func TestTTLMapHooksExpired(t *testing.T) {
+	clock := time.Unix(1000, 0)
+	timeNow = func() time.Time { return clock }
+	defer func() { timeNow = time.Now }()
+
+	var events []string
+	m := NewTTL[string, int](0, 0,
+		WithEvictionHandler(func(key string, value int, reason EvictReason) {
+			events = append(events, fmt.Sprintf("evict %s=%d %v", key, value, reason))
+		}),
+		WithOnSet(func(key string, newV, oldV int, replaced bool) {
+			events = append(events, fmt.Sprintf("set %s=%d old=%d %v", key, newV, oldV, replaced))
+		}),
+		WithOnDelete(func(key string, oldV int, deleted bool) {
+			events = append(events, fmt.Sprintf("delete %s=%d %v", key, oldV, deleted))
+		}),
+	)
+	defer m.Close()
+	m.SetWithTTL("a", 1, time.Minute)
+	m.SetWithTTL("b", 2, time.Minute)
+	clock = clock.Add(time.Minute)
+	events = nil
+
+	if _, replaced := m.SetWithTTL("a", 3, time.Minute); replaced {
+		t.Fatal("expected an expired value to not be reported as replaced")
+	}
+	want := []string{"delete a=1 true", "evict a=1 Expired", "set a=3 old=0 false"}
+	if !slices.Equal(events, want) {
+		t.Fatalf("expected %v, got %v", want, events)
+	}
+
+	events = nil
+	if _, deleted := m.Delete("b"); deleted {
+		t.Fatal("expected deleting an expired value to report false")
+	}
+	want = []string{"delete b=2 true", "evict b=2 Expired"}
+	if !slices.Equal(events, want) {
+		t.Fatalf("expected %v, got %v", want, events)
+	}
+
+	events = nil
+	m.Delete("a")
+	m.Delete("a")
+	want = []string{"delete a=3 true", "evict a=3 Deleted", "delete a=0 false"}
+	if !slices.Equal(events, want) {
+		t.Fatalf("expected %v, got %v", want, events)
+	}
+}
+
+func TestTTLMapJanitor(t *testing.T) {
+	m := NewTTL[int, int](0, time.Millisecond)
+	for i := 0; i < 100; i++ {
+		m.SetWithTTL(i, i, time.Millisecond)
+	}
+	m.Set(-1, -1)
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Len() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the janitor to purge, %v entries left", m.Len())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	m.Close()
+	m.Close()
+	select {
+	case <-m.done:
+	default:
+		t.Fatal("expected the janitor to have stopped")
+	}
+}
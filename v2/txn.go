@@ -0,0 +1,153 @@
+package shardmap
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Txn is the view of the map given to the function passed to Transact. Only the
+// keys passed to Transact may be used, using any other key panics.
+type Txn[K comparable, V any] interface {
+	// Get returns the value for key, including changes made earlier in the
+	// transaction.
+	Get(key K) (value V, ok bool)
+	// Set assigns value to key when the transaction commits.
+	Set(key K, value V)
+	// Delete removes key when the transaction commits.
+	Delete(key K)
+}
+
+// Transact runs fn with the write locks for all shards holding keys, giving it a
+// transaction through which those keys can be read and changed atomically with
+// respect to every other operation on the map.
+//
+// Changes made through the Txn are buffered and only applied to the map, still
+// under the locks, after fn returns nil. If fn returns an error (or panics) the
+// buffer is discarded, which is how a transaction is rolled back: the map is never
+// changed until commit. The error from fn is returned.
+//
+// Shard locks are always acquired in ascending shard index order, so concurrent
+// transactions over overlapping keys cannot deadlock. Rebuild and Resize, which lock
+// every shard, are kept out by the map's layout gate, held by Transact until it
+// returns. Other operations wait for at most one shard lock of the map at a time;
+// Transfer, which also locks a shard of a second map, locks the two maps in a fixed
+// order. Committing changes to a read-only map panics with ErrReadOnly (see
+// SetReadOnly). fn must not call methods on the map itself, as the shards it needs
+// are already locked. Eviction handlers run after the locks are released.
+func (m *Map[K, V]) Transact(keys []K, fn func(txn Txn[K, V]) error) error {
+	tab := m.holdTable()
+	defer m.layout.exit()
+	t := &txn[K, V]{m: m, tab: tab, keys: make(map[K]int, len(keys))}
+	shards := make([]int, 0, len(keys))
+	for _, key := range keys {
+		shard := tab.choose(key)
+		t.keys[key] = shard
+		shards = append(shards, shard)
+	}
+	slices.Sort(shards)
+	shards = slices.Compact(shards)
+
+	var err error
+	var results []txnResult[K, V]
+	func() {
+		for _, shard := range shards {
+			tab.mus[shard].Lock()
+		}
+		defer func() {
+			for i := len(shards) - 1; i >= 0; i-- {
+				tab.mus[shards[i]].Unlock()
+			}
+		}()
+		if err = fn(t); err != nil {
+			return
+		}
+		results = t.commit()
+	}()
+	for _, r := range results {
+		if r.deleted {
+			m.afterDelete(r.key, r.prev)
+			continue
+		}
+		m.afterSet(r.key, r.value, r.prev, r.replaced)
+	}
+	return err
+}
+
+type txn[K comparable, V any] struct {
+	m      *Map[K, V]
+	tab    *table[K, V]
+	keys   map[K]int // key to shard index
+	writes map[K]txnWrite[V]
+}
+
+type txnWrite[V any] struct {
+	value   V
+	deleted bool
+}
+
+type txnResult[K comparable, V any] struct {
+	key      K
+	value    V
+	prev     V
+	replaced bool
+	deleted  bool
+}
+
+func (t *txn[K, V]) shard(key K) int {
+	shard, ok := t.keys[key]
+	if !ok {
+		panic(fmt.Sprintf("shardmap: key %v is not part of the transaction", key))
+	}
+	return shard
+}
+
+func (t *txn[K, V]) Get(key K) (value V, ok bool) {
+	shard := t.shard(key)
+	if w, ok := t.writes[key]; ok {
+		if w.deleted {
+			return value, false
+		}
+		return w.value, true
+	}
+	return t.tab.maps[shard].Get(key)
+}
+
+func (t *txn[K, V]) Set(key K, value V) {
+	t.write(key, txnWrite[V]{value: value})
+}
+
+func (t *txn[K, V]) Delete(key K) {
+	t.write(key, txnWrite[V]{deleted: true})
+}
+
+func (t *txn[K, V]) write(key K, w txnWrite[V]) {
+	t.shard(key)
+	if t.writes == nil {
+		t.writes = map[K]txnWrite[V]{}
+	}
+	t.writes[key] = w
+}
+
+// commit applies the buffered writes. The shard locks must be held.
+func (t *txn[K, V]) commit() []txnResult[K, V] {
+	m, tab := t.m, t.tab
+	if len(t.writes) > 0 {
+		m.checkWrite()
+	}
+	results := make([]txnResult[K, V], 0, len(t.writes))
+	for key, w := range t.writes {
+		shard := t.keys[key]
+		if w.deleted {
+			if prev, ok := m.deleteLocked(tab, shard, key); ok {
+				results = append(results, txnResult[K, V]{key: key, prev: prev, deleted: true})
+			}
+			continue
+		}
+		if m.interner != nil {
+			key = m.interner.intern(key)
+		}
+		prev, replaced := m.setLocked(tab, shard, key, w.value)
+		results = append(results, txnResult[K, V]{key: key, value: w.value, prev: prev, replaced: replaced})
+	}
+	return results
+}
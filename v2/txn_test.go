@@ -0,0 +1,117 @@
+package shardmap
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestTransact(t *testing.T) {
+	var m Map[string, int]
+	m.Set("a", 10)
+	m.Set("b", 0)
+	m.Set("c", 1)
+
+	err := m.Transact([]string{"a", "b", "c"}, func(txn Txn[string, int]) error {
+		a, _ := txn.Get("a")
+		b, _ := txn.Get("b")
+		txn.Set("a", a-5)
+		txn.Set("b", b+5)
+		txn.Delete("c")
+		if v, ok := txn.Get("a"); !ok || v != 5 {
+			t.Fatalf("expected %v, got %v", 5, v)
+		}
+		if _, ok := txn.Get("c"); ok {
+			t.Fatal("expected deleted key to be missing")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := m.Get("a"); v != 5 {
+		t.Fatalf("expected %v, got %v", 5, v)
+	}
+	if v, _ := m.Get("b"); v != 5 {
+		t.Fatalf("expected %v, got %v", 5, v)
+	}
+	if _, ok := m.Get("c"); ok {
+		t.Fatal("expected false")
+	}
+	if m.Len() != 2 {
+		t.Fatalf("expected %v, got %v", 2, m.Len())
+	}
+
+	errRollback := errors.New("rollback")
+	err = m.Transact([]string{"a", "d"}, func(txn Txn[string, int]) error {
+		txn.Set("a", 100)
+		txn.Set("d", 100)
+		return errRollback
+	})
+	if err != errRollback {
+		t.Fatalf("expected %v, got %v", errRollback, err)
+	}
+	if v, _ := m.Get("a"); v != 5 {
+		t.Fatalf("expected %v, got %v", 5, v)
+	}
+	if _, ok := m.Get("d"); ok {
+		t.Fatal("expected rolled back key to be missing")
+	}
+	if m.Len() != 2 {
+		t.Fatalf("expected %v, got %v", 2, m.Len())
+	}
+}
+
+func TestTransactUnknownKey(t *testing.T) {
+	var m Map[string, int]
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic")
+		}
+		// the locks must have been released
+		m.Set("a", 1)
+	}()
+	m.Transact([]string{"a"}, func(txn Txn[string, int]) error {
+		txn.Get("b")
+		return nil
+	})
+}
+
+func TestTransactConcurrent(t *testing.T) {
+	var m Map[int, int]
+	const accounts, total = 16, 1600
+	for i := 0; i < accounts; i++ {
+		m.Set(i, total/accounts)
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				from, to := (w+i)%accounts, (w*7+i*3+1)%accounts
+				if from == to {
+					continue
+				}
+				m.Transact([]int{from, to}, func(txn Txn[int, int]) error {
+					f, _ := txn.Get(from)
+					if f == 0 {
+						return errors.New("empty")
+					}
+					t, _ := txn.Get(to)
+					txn.Set(from, f-1)
+					txn.Set(to, t+1)
+					return nil
+				})
+			}
+		}(w)
+	}
+	wg.Wait()
+	var sum int
+	for _, v := range m.All() {
+		sum += v
+	}
+	if sum != total {
+		t.Fatalf("expected %v, got %v", total, sum)
+	}
+}
@@ -0,0 +1,103 @@
+package shardmap
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	minEmptyPoll = 100 * time.Microsecond
+	maxEmptyPoll = 10 * time.Millisecond
+)
+
+// WaitForEmpty blocks until the map holds no entries or ctx is done, in which case
+// ctx.Err() is returned. It is meant for draining a map used as a work queue
+// before shutting down.
+//
+// WaitForEmpty polls the lock-free per-shard counters that back Len, so it never
+// blocks writers. The poll interval starts at 100µs and doubles up to 10ms while
+// the map stays non-empty. Because every mutation keeps the counters up to date
+// there is no separate signal to miss, but an entry that is added and removed
+// between two polls is not noticed, and the map may be non-empty again by the time
+// WaitForEmpty returns.
+func (m *Map[K, V]) WaitForEmpty(ctx context.Context) error {
+	if m.Len() == 0 {
+		return nil
+	}
+	wait := minEmptyPoll
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+		if m.Len() == 0 {
+			return nil
+		}
+		wait = min(wait*2, maxEmptyPoll)
+		timer.Reset(wait)
+	}
+}
+
+// shardWait is the condition GetWait callers on a shard wait on. Both fields are
+// guarded by the shard's write lock, which is also the condition's Locker.
+type shardWait struct {
+	cond    sync.Cond
+	waiters int
+}
+
+// GetWait returns the value for key, blocking until the key is set if it is not
+// present. If ctx is done first ctx.Err() is returned.
+//
+// Each shard has a condition variable that is broadcast, under the shard's write
+// lock, whenever a key is stored in the shard while someone is waiting on it.
+// Waiters recheck their key after every wakeup, so wakeups caused by other keys of
+// the same shard are handled internally and never returned. Cancellation of ctx
+// wakes the shard's waiters as well. A Set costs nothing extra while nobody waits.
+//
+// Like Get, GetWait does not consume the value: every waiter on the key receives
+// it, which makes the map usable as a rendezvous point for request/response
+// correlation.
+func (m *Map[K, V]) GetWait(ctx context.Context, key K) (V, error) {
+	if value, ok := m.Get(key); ok {
+		return value, nil
+	}
+	for {
+		tab, shard := m.lockKey(key)
+		value, stale, err := m.waitLocked(ctx, tab, shard, key)
+		if !stale {
+			return value, err
+		}
+	}
+}
+
+// waitLocked waits on the shard's condition until key is present or ctx is done.
+// The caller must hold the shard's write lock, which waitLocked releases. stale is
+// set if the table was replaced (see Rebuild) and the wait must start over.
+func (m *Map[K, V]) waitLocked(ctx context.Context, tab *table[K, V], shard int, key K) (value V, stale bool, err error) {
+	defer tab.mus[shard].Unlock()
+	w := &tab.waits[shard]
+	stop := context.AfterFunc(ctx, func() {
+		tab.mus[shard].Lock()
+		w.cond.Broadcast()
+		tab.mus[shard].Unlock()
+	})
+	defer stop()
+	for {
+		if m.tab.Load() != tab {
+			return value, true, nil
+		}
+		if value, ok := tab.maps[shard].Get(key); ok {
+			return value, false, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return value, false, err
+		}
+		w.waiters++
+		w.cond.Wait()
+		w.waiters--
+	}
+}
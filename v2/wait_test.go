@@ -0,0 +1,86 @@
+package shardmap
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWaitForEmpty(t *testing.T) {
+	var m Map[string, int]
+	if err := m.WaitForEmpty(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 100; i++ {
+		m.Set(k(i), i)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := m.WaitForEmpty(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	go func() {
+		for i := 0; i < 100; i++ {
+			time.Sleep(100 * time.Microsecond)
+			m.Delete(k(i))
+		}
+	}()
+	if err := m.WaitForEmpty(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if m.Len() != 0 {
+		t.Fatalf("expected %v, got %v", 0, m.Len())
+	}
+}
+
+func TestGetWait(t *testing.T) {
+	var m Map[string, int]
+	m.Set("present", 1)
+	if v, err := m.GetWait(context.Background(), "present"); err != nil || v != 1 {
+		t.Fatalf("expected 1, <nil>, got %v, %v", v, err)
+	}
+
+	const waiters = 4
+	results := make(chan int, waiters)
+	for i := 0; i < waiters; i++ {
+		go func() {
+			v, err := m.GetWait(context.Background(), "key")
+			if err != nil {
+				t.Error(err)
+			}
+			results <- v
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	// other keys in the shard wake the waiters without satisfying them
+	for i := 0; i < 100; i++ {
+		m.Set(k(i), i)
+	}
+	select {
+	case v := <-results:
+		t.Fatalf("GetWait returned %v before the key was set", v)
+	case <-time.After(10 * time.Millisecond):
+	}
+	m.Set("key", 42)
+	for i := 0; i < waiters; i++ {
+		if v := <-results; v != 42 {
+			t.Fatalf("expected %v, got %v", 42, v)
+		}
+	}
+}
+
+func TestGetWaitCanceled(t *testing.T) {
+	var m Map[string, int]
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := m.GetWait(ctx, "key"); err != context.DeadlineExceeded {
+		t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	for i := range m.table().waits {
+		if m.table().waits[i].waiters != 0 {
+			t.Fatalf("shard %d: expected no waiters, got %v", i, m.table().waits[i].waiters)
+		}
+	}
+}